@@ -0,0 +1,32 @@
+// kms-standin — локальная замена KMS для разработки: хранит ключи в своём файле
+// и только шифрует и расшифровывает ими ключи данных, сами ключи не отдаёт.
+//
+//	go run ./cmd/pii-rotate -new-key          # создать pii-keys.json (или возьмите готовый)
+//	go run ./cmd/kms-standin -addr :9443 -keys pii-keys.json -token <токен>
+//
+// В config.json: "pii": {"provider": "kms", "kms": {"url": "http://localhost:9443",
+// "key_id": "<id ключа из файла>", "token": "<токен>"}, "index_key": "..."}
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"online_bank/internal/pii"
+)
+
+func main() {
+	addr := flag.String("addr", ":9443", "адрес для приёма запросов")
+	keysPath := flag.String("keys", pii.DefaultKeyfile, "файл ключей")
+	token := flag.String("token", "", "токен для Authorization: Bearer; пустой — без проверки")
+	flag.Parse()
+
+	keys, err := pii.LoadKeyfile(*keysPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("KMS слушает %s, текущий ключ %s", *addr, keys.CurrentKeyID())
+	log.Fatal(http.ListenAndServe(*addr, pii.KMSHandler(keys, *token)))
+}
@@ -0,0 +1,82 @@
+// pii-rotate — смена ключа шифрования персональных данных.
+//
+//	go run ./cmd/pii-rotate -new-key   # добавить новый ключ в pii-keys.json и сделать текущим
+//	# перезапустить сервер, чтобы он знал новый ключ
+//	go run ./cmd/pii-rotate            # перешифровать строки, зашифрованные прежними ключами
+//
+// Без файла ключей -new-key создаёт его. Для провайдера "kms" ключ меняется в самом KMS
+// и в pii.kms.key_id, после чего запускается вторая команда. Старый ключ можно удалить,
+// когда вторая команда сообщит, что перешифровывать больше нечего.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io/fs"
+	"log"
+
+	"online_bank/config"
+	"online_bank/db"
+	"online_bank/internal/pii"
+	"online_bank/internal/user"
+)
+
+func main() {
+	configPath := flag.String("config", "config.json", "путь к config.json")
+	newKey := flag.Bool("new-key", false, "создать новый ключ в файле ключей и выйти")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("не удалось прочитать %s: %v", *configPath, err)
+	}
+
+	if *newKey {
+		if cfg.PII.Provider != "" && cfg.PII.Provider != pii.ProviderKeyfile {
+			log.Fatal("-new-key работает только с файлом ключей; для KMS смените pii.kms.key_id")
+		}
+		path := cfg.PII.KeyfilePath()
+		keys, err := pii.LoadKeyfile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			keys, err = &pii.Keyfile{}, nil
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		id, err := keys.AddKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := keys.Save(path); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("ключ %s добавлен в %s и стал текущим", id, path)
+		return
+	}
+
+	database, err := db.Connect(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer database.Close()
+	if err := db.Migrate(database); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	keys, err := pii.NewProvider(cfg.PII)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cipher, err := pii.New(ctx, keys, cfg.PII.IndexKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	n, err := user.NewUserRepository(database, cfg.DBTimeouts, cipher).ReencryptPII(ctx, cipher.CurrentPattern())
+	if err != nil {
+		log.Fatalf("перешифровано %d пользователей, затем ошибка: %v", n, err)
+	}
+	log.Printf("перешифровано %d пользователей ключом %s", n, cipher.KeyID())
+}
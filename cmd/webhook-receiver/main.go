@@ -0,0 +1,53 @@
+// webhook-receiver — локальный приёмник вебхуков для проверки: печатает события
+// и проверяет подпись.
+//
+//	go run ./cmd/webhook-receiver -addr :9090 -secret <секрет из /webhooks>
+//
+// Затем зарегистрируйте вебхук на http://localhost:9090/ и нажмите «Проверить».
+// С -fail приёмник отвечает 500 — так видно повторы и список недоставленных.
+package main
+
+import (
+	"crypto/hmac"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+
+	"online_bank/internal/webhook"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "адрес для приёма запросов")
+	secret := flag.String("secret", "", "секрет вебхука для проверки подписи")
+	fail := flag.Bool("fail", false, "отвечать 500 на все запросы")
+	flag.Parse()
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		signature := "не проверялась"
+		if *secret != "" {
+			want := webhook.Sign(*secret, r.Header.Get("X-Webhook-Timestamp"), body)
+			if hmac.Equal([]byte(want), []byte(r.Header.Get("X-Webhook-Signature"))) {
+				signature = "верна"
+			} else {
+				signature = "НЕВЕРНА"
+			}
+		}
+		log.Printf("%s %s (подпись %s): %s", r.Header.Get("X-Webhook-Event"), r.Header.Get("X-Webhook-Id"), signature, body)
+
+		if *fail {
+			http.Error(w, "receiver configured to fail", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	log.Println("Приёмник вебхуков слушает", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -3,6 +3,18 @@ package config
 import (
 	"encoding/json"
 	"os"
+
+	"online_bank/internal/fee"
+	"online_bank/internal/kyc"
+	"online_bank/internal/limits"
+	"online_bank/internal/logging"
+	"online_bank/internal/mailer"
+	"online_bank/internal/pii"
+	"online_bank/internal/ratelimit"
+	"online_bank/internal/security"
+	"online_bank/internal/timeouts"
+	"online_bank/internal/tracing"
+	"online_bank/internal/user"
 )
 
 
@@ -10,6 +22,35 @@ type Config struct {
 	DBUser     string `json:"db_user"`
 	DBPassword string `json:"db_password"`
 	DBName     string `json:"db_name"`
+	Limits     limits.Policy `json:"limits"`
+	Fees       fee.Config    `json:"fees"`
+	// Ключ подписи платёжных QR-кодов
+	PaymentCodeSecret string `json:"payment_code_secret"`
+	// Адрес сайта для ссылок в QR-кодах, например https://bank.example.com
+	PublicURL string `json:"public_url"`
+	// Ключ для кодов проверки квитанций
+	ReceiptSecret string `json:"receipt_secret"`
+	SMTP          mailer.Config `json:"smtp"`
+	Log           logging.Config `json:"log"`
+	Tracing       tracing.Config `json:"tracing"`
+	// Токен для /metrics; пустой — метрики открыты всем
+	MetricsToken string `json:"metrics_token"`
+	// Как часто обновлять курсы валют; 0 — раз в час
+	RatesRefreshMinutes int `json:"rates_refresh_minutes"`
+	// Таймауты запросов к БД: общий и для отдельных операций
+	DBTimeouts timeouts.Config `json:"db_timeouts"`
+	// Ограничение частоты запросов по IP и пользователю для отдельных маршрутов
+	RateLimit ratelimit.Config `json:"rate_limit"`
+	// HSTS и режим CSP
+	SecurityHeaders security.Config `json:"security_headers"`
+	// Cookie входа: Secure, SameSite и ключи подписи
+	Session user.SessionConfig `json:"session"`
+	// Шифрование персональных данных: ключи и секрет слепых индексов
+	PII pii.Config `json:"pii"`
+	// Проверка личности: лимиты по уровням, приветственный бонус, размер документов
+	KYC kyc.Config `json:"kyc"`
+	// Разрешить вебхуки на внутренние адреса (localhost, 10.0.0.0/8 …) — только для локальной проверки
+	WebhookAllowPrivate bool `json:"webhook_allow_private_addresses"`
 }
 
 func LoadConfig(filename string) (*Config, error) {
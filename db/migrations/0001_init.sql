@@ -0,0 +1,35 @@
+-- Исходная схема. IF NOT EXISTS, чтобы не трогать уже созданные вручную таблицы.
+CREATE TABLE IF NOT EXISTS users (
+    id          SERIAL PRIMARY KEY,
+    name        TEXT NOT NULL,
+    email       TEXT NOT NULL UNIQUE,
+    password    TEXT NOT NULL,
+    balance_tjs NUMERIC(18, 2) NOT NULL DEFAULT 0,
+    balance_usd NUMERIC(18, 2) NOT NULL DEFAULT 0,
+    balance_eur NUMERIC(18, 2) NOT NULL DEFAULT 0,
+    created_at  TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+    token      TEXT PRIMARY KEY,
+    user_id    INT NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS profiles (
+    user_id     INT PRIMARY KEY REFERENCES users(id),
+    full_name   TEXT NOT NULL DEFAULT '',
+    bio         TEXT NOT NULL DEFAULT '',
+    avatar_path TEXT NOT NULL DEFAULT '',
+    updated_at  TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id          SERIAL PRIMARY KEY,
+    user_id     INT NOT NULL REFERENCES users(id),
+    type        TEXT NOT NULL,
+    amount      NUMERIC(18, 2) NOT NULL,
+    currency    TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'customer';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS frozen BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Компенсирующая запись ссылается на исходную операцию
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reversal_of INT REFERENCES transactions(id);
+CREATE UNIQUE INDEX IF NOT EXISTS transactions_reversal_of_idx ON transactions(reversal_of);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          SERIAL PRIMARY KEY,
+    actor_id    INT REFERENCES users(id),
+    action      TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id   INT,
+    details     TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMP NOT NULL DEFAULT NOW()
+);
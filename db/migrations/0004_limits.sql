@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tier TEXT NOT NULL DEFAULT 'standard';
+
+CREATE INDEX IF NOT EXISTS transactions_user_created_idx ON transactions(user_id, created_at);
@@ -0,0 +1,4 @@
+-- Системный счёт доходов от комиссий. Пароль '!' не является bcrypt-хешем, войти под ним нельзя.
+INSERT INTO users (name, email, password, balance_tjs, balance_usd, balance_eur, created_at, role)
+SELECT 'Доходы от комиссий', 'fees@online-bank.local', '!', 0, 0, 0, NOW(), 'system'
+WHERE NOT EXISTS (SELECT 1 FROM users WHERE email = 'fees@online-bank.local');
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS scheduled_transfers (
+    id             SERIAL PRIMARY KEY,
+    user_id        INT NOT NULL REFERENCES users(id),
+    to_id          INT NOT NULL REFERENCES users(id),
+    amount         NUMERIC(18, 2) NOT NULL,
+    currency       TEXT NOT NULL,
+    frequency      TEXT NOT NULL,
+    next_run_at    TIMESTAMP NOT NULL,
+    end_date       TIMESTAMP,
+    remaining_runs INT,
+    status         TEXT NOT NULL DEFAULT 'active',
+    attempts       INT NOT NULL DEFAULT 0,
+    last_error     TEXT NOT NULL DEFAULT '',
+    last_run_at    TIMESTAMP,
+    created_at     TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_transfers_due_idx ON scheduled_transfers(status, next_run_at);
+CREATE INDEX IF NOT EXISTS scheduled_transfers_user_idx ON scheduled_transfers(user_id);
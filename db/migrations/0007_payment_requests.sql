@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS payment_requests (
+    id           SERIAL PRIMARY KEY,
+    requester_id INT NOT NULL REFERENCES users(id),
+    payer_id     INT NOT NULL REFERENCES users(id),
+    amount       NUMERIC(18, 2) NOT NULL,
+    currency     TEXT NOT NULL,
+    note         TEXT NOT NULL DEFAULT '',
+    status       TEXT NOT NULL DEFAULT 'pending',
+    expires_at   TIMESTAMP NOT NULL,
+    created_at   TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS payment_requests_payer_idx ON payment_requests(payer_id, status);
+CREATE INDEX IF NOT EXISTS payment_requests_requester_idx ON payment_requests(requester_id);
+
+-- История смены статусов запроса
+CREATE TABLE IF NOT EXISTS payment_request_events (
+    id         SERIAL PRIMARY KEY,
+    request_id INT NOT NULL REFERENCES payment_requests(id),
+    status     TEXT NOT NULL,
+    actor_id   INT REFERENCES users(id),
+    note       TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS payment_request_events_request_idx ON payment_request_events(request_id);
@@ -0,0 +1,18 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS counterparty_id INT REFERENCES users(id);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS refund_of INT REFERENCES transactions(id);
+
+-- Отмена перевода порождает записи у обеих сторон, ссылающиеся на одну исходную операцию
+DROP INDEX IF EXISTS transactions_reversal_of_idx;
+CREATE INDEX IF NOT EXISTS transactions_reversal_of_idx ON transactions(reversal_of);
+CREATE INDEX IF NOT EXISTS transactions_refund_of_idx ON transactions(refund_of);
+
+-- Старые переводы знали контрагента только по тексту описания ("... пользователю 5")
+UPDATE transactions t
+SET counterparty_id = substring(t.description from '(\d+)$')::int
+WHERE t.type = 'transfer'
+  AND t.counterparty_id IS NULL
+  AND t.description ~ '\d+$'
+  AND EXISTS (SELECT 1 FROM users u WHERE u.id = substring(t.description from '(\d+)$')::int);
+
+-- Вторая сторона той же операции (перевод, комиссия, возврат, отмена)
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS linked_id INT REFERENCES transactions(id);
@@ -0,0 +1,16 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reference TEXT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'completed';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS rate NUMERIC(18, 8);
+
+UPDATE transactions
+SET reference = 'TX' || to_char(created_at, 'YYMMDD') || upper(substr(md5(id::text || random()::text), 1, 10))
+WHERE reference IS NULL;
+
+ALTER TABLE transactions ALTER COLUMN reference SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS transactions_reference_idx ON transactions(reference);
+
+-- Для старых отмен и возвратов проставляем статус исходной операции
+UPDATE transactions t SET status = 'reversed'
+WHERE EXISTS (SELECT 1 FROM transactions r WHERE r.reversal_of = t.id);
+UPDATE transactions t SET status = 'refunded'
+WHERE t.status = 'completed' AND EXISTS (SELECT 1 FROM transactions r WHERE r.refund_of = t.id);
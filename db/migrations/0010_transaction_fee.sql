@@ -0,0 +1,2 @@
+-- Комиссия, удержанная вместе с операцией; хранится на строке плательщика для квитанций
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fee NUMERIC(18, 2) NOT NULL DEFAULT 0;
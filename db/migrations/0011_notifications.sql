@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS notifications (
+    id         SERIAL PRIMARY KEY,
+    user_id    INT NOT NULL REFERENCES users(id),
+    kind       TEXT NOT NULL,
+    message    TEXT NOT NULL,
+    read_at    TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_idx ON notifications(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS notifications_unread_idx ON notifications(user_id) WHERE read_at IS NULL;
+
+-- Отсутствие строки означает настройки по умолчанию для этого вида
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INT NOT NULL REFERENCES users(id),
+    kind    TEXT NOT NULL,
+    in_app  BOOLEAN NOT NULL,
+    email   BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, kind)
+);
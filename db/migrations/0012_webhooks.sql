@@ -0,0 +1,42 @@
+-- user_id IS NULL — общесистемный вебхук, его заводит администратор и получает события всех пользователей
+CREATE TABLE IF NOT EXISTS webhooks (
+    id         SERIAL PRIMARY KEY,
+    user_id    INT REFERENCES users(id),
+    url        TEXT NOT NULL,
+    secret     TEXT NOT NULL,
+    events     TEXT[] NOT NULL DEFAULT '{}',
+    active     BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_user_idx ON webhooks(user_id) WHERE active;
+
+-- Очередь доставки: pending ждёт отправки, delivered доставлено, dead — попытки исчерпаны
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id              SERIAL PRIMARY KEY,
+    webhook_id      INT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_id        TEXT NOT NULL,
+    event_type      TEXT NOT NULL,
+    payload         TEXT NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending',
+    attempts        INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_error      TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+    delivered_at    TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx ON webhook_deliveries(webhook_id, created_at DESC);
+
+-- Журнал каждой попытки доставки
+CREATE TABLE IF NOT EXISTS webhook_attempts (
+    id           SERIAL PRIMARY KEY,
+    delivery_id  INT NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+    status_code  INT NOT NULL DEFAULT 0,
+    error        TEXT NOT NULL DEFAULT '',
+    duration_ms  INT NOT NULL,
+    attempted_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_attempts_delivery_idx ON webhook_attempts(delivery_id);
@@ -0,0 +1,19 @@
+-- События, записанные в одной транзакции с операцией. Реле отправляет их подписчикам
+-- и проставляет published_at; до этого строка повторяется (доставка «хотя бы раз»).
+CREATE TABLE IF NOT EXISTS outbox (
+    id              BIGSERIAL PRIMARY KEY,
+    event_id        TEXT NOT NULL UNIQUE,
+    event_type      TEXT NOT NULL,
+    user_id         INT NOT NULL,
+    payload         TEXT NOT NULL,
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+    attempts        INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_error      TEXT NOT NULL DEFAULT '',
+    published_at    TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox(next_attempt_at, id) WHERE published_at IS NULL;
+
+-- Повторная отправка события из outbox не должна ставить вебхук в очередь дважды
+CREATE UNIQUE INDEX IF NOT EXISTS webhook_deliveries_event_idx ON webhook_deliveries(webhook_id, event_id);
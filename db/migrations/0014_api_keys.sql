@@ -0,0 +1,27 @@
+-- Ключи хранятся только в виде SHA-256 от секрета; prefix — открытая часть для поиска
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           SERIAL PRIMARY KEY,
+    user_id      INT NOT NULL REFERENCES users(id),
+    name         TEXT NOT NULL,
+    prefix       TEXT NOT NULL UNIQUE,
+    secret_hash  TEXT NOT NULL,
+    scopes       TEXT[] NOT NULL,
+    expires_at   TIMESTAMP,
+    revoked_at   TIMESTAMP,
+    last_used_at TIMESTAMP,
+    last_used_ip TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_idx ON api_keys(user_id);
+
+-- Короткоживущие токены OAuth2 (client credentials), выданные по API-ключу
+CREATE TABLE IF NOT EXISTS api_access_tokens (
+    token_hash TEXT PRIMARY KEY,
+    key_id     INT NOT NULL REFERENCES api_keys(id),
+    scopes     TEXT[] NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS api_access_tokens_expires_idx ON api_access_tokens(expires_at);
@@ -0,0 +1,2 @@
+-- Идентификатор HTTP-запроса: по нему запись журнала находится в логах
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS request_id TEXT NOT NULL DEFAULT '';
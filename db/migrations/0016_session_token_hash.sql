@@ -0,0 +1,4 @@
+-- Токены входа хранятся только в виде SHA-256: утечка таблицы не даёт войти в чужой аккаунт.
+-- Уже выданные токены хешируются на месте, поэтому пользователей не выкидывает из сессий.
+ALTER TABLE user_tokens RENAME COLUMN token TO token_hash;
+UPDATE user_tokens SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
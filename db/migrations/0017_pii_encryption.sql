@@ -0,0 +1,6 @@
+-- Имя, email, ФИО и «о себе» шифруются в приложении (internal/pii), поэтому уникальность
+-- и поиск email переезжают на слепой индекс — HMAC от email в нижнем регистре.
+-- Существующие строки шифруются при запуске сервера, он же заполняет email_index.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_index TEXT;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_index_idx ON users(email_index);
@@ -0,0 +1,33 @@
+-- Уровень проверки личности: unverified, basic (паспорт) или full (паспорт и селфи).
+-- Уже зарегистрированные пользователи пользовались переводами без проверки, поэтому
+-- получают basic, а приветственный бонус у них считается выплаченным при регистрации.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS kyc_level TEXT NOT NULL DEFAULT 'unverified';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS welcome_bonus_paid BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE users SET kyc_level = 'basic', welcome_bonus_paid = TRUE;
+
+-- Заявка на повышение уровня; у пользователя не больше одной заявки на рассмотрении
+CREATE TABLE IF NOT EXISTS kyc_submissions (
+    id          SERIAL PRIMARY KEY,
+    user_id     INT NOT NULL REFERENCES users(id),
+    level       TEXT NOT NULL,
+    status      TEXT NOT NULL DEFAULT 'pending',
+    reason      TEXT NOT NULL DEFAULT '',
+    reviewer_id INT REFERENCES users(id),
+    created_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+    reviewed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS kyc_submissions_status_idx ON kyc_submissions(status, created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS kyc_submissions_pending_idx ON kyc_submissions(user_id) WHERE status = 'pending';
+
+-- Файлы документов лежат в uploads/kyc/ и отдаются только через админку
+CREATE TABLE IF NOT EXISTS kyc_documents (
+    id            SERIAL PRIMARY KEY,
+    submission_id INT NOT NULL REFERENCES kyc_submissions(id),
+    kind          TEXT NOT NULL,
+    path          TEXT NOT NULL,
+    content_type  TEXT NOT NULL,
+    created_at    TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS kyc_documents_submission_idx ON kyc_documents(submission_id);
@@ -0,0 +1,3 @@
+-- Назначение платежа из QR-кода (например, номер заказа) — по нему получатель
+-- сопоставляет оплату со своим заказом
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS payment_reference TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- scheduled_at — плановое время текущего периода; next_run_at может быть сдвинут повтором
+-- после ошибки, а следующий период считается от плана, чтобы расписание не уплывало.
+ALTER TABLE scheduled_transfers ADD COLUMN IF NOT EXISTS scheduled_at TIMESTAMP;
+UPDATE scheduled_transfers SET scheduled_at = next_run_at WHERE scheduled_at IS NULL;
+ALTER TABLE scheduled_transfers ALTER COLUMN scheduled_at SET NOT NULL;
+
+-- Задание, взятое воркером, не достаётся другому экземпляру до locked_until
+ALTER TABLE scheduled_transfers ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
@@ -0,0 +1,24 @@
+-- Оплата запроса теперь меняет статус в транзакции перевода, и статус processing больше
+-- не назначается. Зависшие в нём запросы разбираются по журналу операций: если перевод
+-- от плательщика получателю на эту сумму прошёл после последней смены статуса, запрос
+-- оплачен, иначе он снова ждёт ответа.
+WITH paid AS (
+    UPDATE payment_requests p SET status = 'approved', updated_at = NOW()
+    WHERE p.status = 'processing' AND EXISTS (
+        SELECT 1 FROM transactions t
+        WHERE t.user_id = p.payer_id AND t.counterparty_id = p.requester_id
+          AND t.type = 'transfer' AND t.amount = -p.amount AND t.currency = p.currency
+          AND t.created_at >= p.updated_at
+    )
+    RETURNING p.id
+)
+INSERT INTO payment_request_events (request_id, status, note, created_at)
+SELECT id, 'approved', 'восстановлено по журналу операций', NOW() FROM paid;
+
+WITH unpaid AS (
+    UPDATE payment_requests SET status = 'pending', updated_at = NOW()
+    WHERE status = 'processing'
+    RETURNING id
+)
+INSERT INTO payment_request_events (request_id, status, note, created_at)
+SELECT id, 'pending', 'оплата не прошла', NOW() FROM unpaid;
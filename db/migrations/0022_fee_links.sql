@@ -0,0 +1,19 @@
+-- fee_for — операция, за которую списана комиссия; по ней отмена операции отменяет и комиссию
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fee_for INT REFERENCES transactions(id);
+CREATE INDEX IF NOT EXISTS transactions_fee_for_idx ON transactions(fee_for) WHERE fee_for IS NOT NULL;
+
+-- Старые комиссии связываются с ближайшей предшествующей операцией плательщика
+-- с той же суммой комиссии, записанной в той же транзакции
+UPDATE transactions f SET fee_for = (
+    SELECT t.id FROM transactions t
+    WHERE t.user_id = f.user_id AND t.type IN ('transfer', 'conversion') AND t.amount < 0
+      AND t.currency = f.currency AND t.fee = -f.amount
+      AND t.id < f.id AND f.created_at - t.created_at < INTERVAL '1 second'
+    ORDER BY t.id DESC
+    LIMIT 1
+)
+WHERE f.type = 'fee' AND f.fee_for IS NULL;
+
+UPDATE transactions i SET fee_for = f.fee_for
+FROM transactions f
+WHERE i.type = 'fee_income' AND i.fee_for IS NULL AND i.linked_id = f.id AND f.fee_for IS NOT NULL;
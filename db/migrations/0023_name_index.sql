@@ -0,0 +1,4 @@
+-- Слепой индекс имени для поиска в админке по имени целиком (без учёта регистра
+-- и лишних пробелов). Существующие строки заполняет сервер при запуске.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS name_index TEXT;
+CREATE INDEX IF NOT EXISTS users_name_index_idx ON users(name_index);
@@ -0,0 +1,6 @@
+-- События outbox, по которым уведомление уже доставлено: relay повторяет событие всем
+-- получателям, если не справился один из них. Строка удаляется вместе с событием из outbox.
+CREATE TABLE IF NOT EXISTS notification_events (
+    event_id     TEXT PRIMARY KEY REFERENCES outbox(event_id) ON DELETE CASCADE,
+    delivered_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -3,9 +3,11 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"log/slog"
 	"online_bank/config"
+	"online_bank/internal/tracing"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 func Connect(cfg *config.Config) (*sql.DB, error) {
@@ -14,15 +16,17 @@ func Connect(cfg *config.Config) (*sql.DB, error) {
 		cfg.DBUser, cfg.DBPassword, cfg.DBName,
 	)
 
-	db, err := sql.Open("postgres", connStr)
+	connector, err := pq.NewConnector(connStr)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при открытии соединения: %v", err)
 	}
+	// Каждый SQL-запрос получает спан трассировки
+	db := sql.OpenDB(tracing.Connector(connector))
 
 	if err = db.Ping(); err != nil {
 		return nil, fmt.Errorf("не удалось подключиться к БД: %v", err)
 	}
 
-	fmt.Println("Подключено к PostgreSQL!")
+	slog.Info("подключено к PostgreSQL", "db", cfg.DBName)
 	return db, nil
 }
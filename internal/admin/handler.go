@@ -0,0 +1,217 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"online_bank/internal/audit"
+	"online_bank/internal/currency"
+	"online_bank/internal/user"
+)
+
+type AdminHandler struct {
+	service   *AdminService
+	templates *template.Template
+}
+
+func NewAdminHandler(service *AdminService, templates *template.Template) *AdminHandler {
+	return &AdminHandler{service: service, templates: templates}
+}
+
+type userPage struct {
+	User         *user.User
+	Transactions []*user.Transactions
+	Currencies   []string
+	IsAdmin      bool
+}
+
+func (h *AdminHandler) SearchPage(w http.ResponseWriter, r *http.Request) {
+	query := r.FormValue("q")
+
+	users, err := h.service.SearchUsers(r.Context(), query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.templates.ExecuteTemplate(w, "admin.html", map[string]interface{}{
+		"Query": query,
+		"Users": users,
+	})
+}
+
+func (h *AdminHandler) UserPage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	u, txs, err := h.service.GetUser(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	h.templates.ExecuteTemplate(w, "admin_user.html", userPage{
+		User:         u,
+		Transactions: txs,
+		Currencies:   currency.Supported,
+		IsAdmin:      user.CurrentUser(r.Context()).Role == user.RoleAdmin,
+	})
+}
+
+func (h *AdminHandler) FreezePage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return
+	}
+	frozen := r.FormValue("frozen") == "1"
+
+	err = h.service.SetFrozen(r.Context(), actor(r), userID, frozen)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/user?id=%d", userID), http.StatusSeeOther)
+}
+
+func (h *AdminHandler) ReversePage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	txID, err := strconv.Atoi(r.FormValue("tx_id"))
+	if err != nil {
+		http.Error(w, "invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return
+	}
+	reason := r.FormValue("reason")
+
+	err = h.service.ReverseTransaction(r.Context(), actor(r), txID, reason)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/user?id=%d", userID), http.StatusSeeOther)
+}
+
+func (h *AdminHandler) AdjustPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return
+	}
+	amount, err := strconv.ParseFloat(r.FormValue("amount"), 64)
+	if err != nil {
+		http.Error(w, "invalid amount", http.StatusBadRequest)
+		return
+	}
+	cur := r.FormValue("currency")
+	reason := r.FormValue("reason")
+
+	err = h.service.AdjustBalance(r.Context(), actor(r), userID, cur, amount, reason)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/user?id=%d", userID), http.StatusSeeOther)
+}
+
+func (h *AdminHandler) TierPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.SetTier(r.Context(), actor(r), userID, r.FormValue("tier"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/user?id=%d", userID), http.StatusSeeOther)
+}
+
+func (h *AdminHandler) AuditPage(w http.ResponseWriter, r *http.Request) {
+	f := audit.Filter{
+		Action:     r.FormValue("action"),
+		TargetType: r.FormValue("target_type"),
+	}
+	f.ActorID, _ = strconv.Atoi(r.FormValue("actor_id"))
+	f.TargetID, _ = strconv.Atoi(r.FormValue("target_id"))
+	f.Limit, _ = strconv.Atoi(r.FormValue("limit"))
+	if from := r.FormValue("from"); from != "" {
+		f.From, _ = time.Parse("2006-01-02", from)
+	}
+	if to := r.FormValue("to"); to != "" {
+		if t, err := time.Parse("2006-01-02", to); err == nil {
+			f.To = t.AddDate(0, 0, 1)
+		}
+	}
+
+	entries, err := h.service.Audit(r.Context(), f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.FormValue("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+
+	h.templates.ExecuteTemplate(w, "admin_audit.html", map[string]interface{}{
+		"Form":    r.Form,
+		"Entries": entries,
+	})
+}
+
+func (h *AdminHandler) AuditVerifyPage(w http.ResponseWriter, r *http.Request) {
+	brokenID, err := h.service.VerifyAudit(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"valid":     brokenID == 0,
+		"broken_id": brokenID,
+	})
+}
+
+func actor(r *http.Request) audit.Actor {
+	return audit.ActorFromRequest(r, user.CurrentUser(r.Context()).ID)
+}
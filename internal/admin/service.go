@@ -0,0 +1,100 @@
+package admin
+
+import (
+	"context"
+	"log/slog"
+
+	"online_bank/internal/audit"
+	"online_bank/internal/user"
+)
+
+type AdminService struct {
+	users *user.UserService
+	audit *audit.AuditService
+}
+
+func NewAdminService(users *user.UserService, audit *audit.AuditService) *AdminService {
+	return &AdminService{users: users, audit: audit}
+}
+
+func (s *AdminService) SearchUsers(ctx context.Context, query string) ([]*user.User, error) {
+	return s.users.SearchUsers(ctx, query)
+}
+
+func (s *AdminService) GetUser(ctx context.Context, id int) (*user.User, []*user.Transactions, error) {
+	u, err := s.users.GetBalance(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	txs, err := s.users.GetTransactions(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return u, txs, nil
+}
+
+func (s *AdminService) SetFrozen(ctx context.Context, actor audit.Actor, userID int, frozen bool) error {
+	action := "account.unfreeze"
+	if frozen {
+		action = "account.freeze"
+	}
+
+	err := s.users.SetFrozen(ctx, userID, frozen)
+	s.record(ctx, actor, action, "user", userID,
+		map[string]bool{"frozen": !frozen}, map[string]bool{"frozen": frozen}, err)
+	return err
+}
+
+func (s *AdminService) ReverseTransaction(ctx context.Context, actor audit.Actor, txID int, reason string) error {
+	orig, err := s.users.ReverseTransaction(ctx, txID, reason)
+	var before interface{}
+	if orig != nil {
+		before = orig
+	}
+	s.record(ctx, actor, "transaction.reverse", "transaction", txID, before, map[string]string{"reason": reason}, err)
+	return err
+}
+
+func (s *AdminService) AdjustBalance(ctx context.Context, actor audit.Actor, userID int, cur string, amount float64, reason string) error {
+	before := s.balances(ctx, userID)
+	err := s.users.AdjustBalance(ctx, userID, cur, amount, reason)
+	after := s.balances(ctx, userID)
+	after["reason"] = reason
+	s.record(ctx, actor, "balance.adjust", "user", userID, before, after, err)
+	return err
+}
+
+func (s *AdminService) SetTier(ctx context.Context, actor audit.Actor, userID int, tier string) error {
+	var before interface{}
+	if u, err := s.users.GetBalance(ctx, userID); err == nil {
+		before = map[string]string{"tier": u.Tier}
+	}
+	err := s.users.SetTier(ctx, userID, tier)
+	s.record(ctx, actor, "account.tier", "user", userID, before, map[string]string{"tier": tier}, err)
+	return err
+}
+
+func (s *AdminService) Audit(ctx context.Context, f audit.Filter) ([]*audit.Entry, error) {
+	return s.audit.Query(ctx, f)
+}
+
+func (s *AdminService) VerifyAudit(ctx context.Context) (int, error) {
+	return s.audit.Verify(ctx)
+}
+
+func (s *AdminService) balances(ctx context.Context, userID int) map[string]interface{} {
+	u, err := s.users.GetBalance(ctx, userID)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{"TJS": u.BalanceTJS, "USD": u.BalanceUSD, "EUR": u.BalanceEUR}
+}
+
+// record не прерывает операцию, если журнал недоступен, но пишет об этом в лог
+// Запись не зависит от отмены запроса: операция уже выполнена или отклонена.
+func (s *AdminService) record(ctx context.Context, actor audit.Actor, action, targetType string, targetID int, before, after interface{}, opErr error) {
+	ctx = context.WithoutCancel(ctx)
+	if err := s.audit.Record(ctx, actor, action, targetType, targetID, before, after, opErr); err != nil {
+		slog.ErrorContext(ctx, "не удалось записать в журнал аудита", "action", action, "err", err)
+	}
+}
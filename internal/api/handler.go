@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"online_bank/internal/apikey"
+	"online_bank/internal/audit"
+	"online_bank/internal/user"
+)
+
+// APIHandler — JSON API для интеграций. Доступ проверяет apikey.Middleware,
+// пользователь берётся из контекста, как и в HTML-обработчиках.
+type APIHandler struct {
+	users *user.UserService
+	audit *audit.AuditService
+}
+
+func NewAPIHandler(users *user.UserService, audit *audit.AuditService) *APIHandler {
+	return &APIHandler{users: users, audit: audit}
+}
+
+type me struct {
+	ID       int                `json:"id"`
+	Name     string             `json:"name"`
+	Email    string             `json:"email"`
+	Tier     string             `json:"tier"`
+	Frozen   bool               `json:"frozen"`
+	Balances map[string]float64 `json:"balances"`
+}
+
+// MePage — GET /api/v1/me: профиль и балансы
+func (h *APIHandler) MePage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	u := user.CurrentUser(r.Context())
+	writeJSON(w, http.StatusOK, me{
+		ID:       u.ID,
+		Name:     u.Name,
+		Email:    u.Email,
+		Tier:     u.Tier,
+		Frozen:   u.Frozen,
+		Balances: map[string]float64{"TJS": u.BalanceTJS, "USD": u.BalanceUSD, "EUR": u.BalanceEUR},
+	})
+}
+
+// TransactionsPage — GET /api/v1/transactions: история операций;
+// с ?ref= — одна операция по номеру
+func (h *APIHandler) TransactionsPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	u := user.CurrentUser(r.Context())
+
+	if ref := r.FormValue("ref"); ref != "" {
+		t, err := h.users.GetTransaction(r.Context(), u.ID, ref)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, t.Event())
+		return
+	}
+
+	list, err := h.users.GetTransactions(r.Context(), u.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := make([]user.TransactionEvent, 0, len(list))
+	for _, t := range list {
+		out = append(out, t.Event())
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+type transferRequest struct {
+	ToID     int     `json:"to_id"`
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+// TransferPage — POST /api/v1/transfers {"to_id": 2, "amount": 10, "currency": "TJS"}
+func (h *APIHandler) TransferPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	u := user.CurrentUser(r.Context())
+
+	var req transferRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	err := h.users.Transfer(r.Context(), u.ID, req.ToID, req.Amount, req.Currency)
+	h.record(r, u.ID, req, err)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"status": "completed"})
+}
+
+// record пишет перевод через API в журнал аудита вместе с номером ключа
+func (h *APIHandler) record(r *http.Request, userID int, req transferRequest, opErr error) {
+	after := map[string]interface{}{
+		"to_id":    req.ToID,
+		"amount":   req.Amount,
+		"currency": req.Currency,
+		"api_key":  apikey.PrincipalFrom(r.Context()).KeyID,
+	}
+	err := h.audit.Record(r.Context(), audit.ActorFromRequest(r, userID), "money.transfer", "user", req.ToID, nil, after, opErr)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "не удалось записать в журнал аудита", "action", "money.transfer", "err", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,128 @@
+package apikey
+
+import (
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"online_bank/internal/audit"
+	"online_bank/internal/user"
+)
+
+type APIKeyHandler struct {
+	service   *APIKeyService
+	audit     *audit.AuditService
+	templates *template.Template
+}
+
+func NewAPIKeyHandler(service *APIKeyService, audit *audit.AuditService, templates *template.Template) *APIKeyHandler {
+	return &APIKeyHandler{service: service, audit: audit, templates: templates}
+}
+
+// ListPage — ключи пользователя и форма выпуска нового. Выпущенный ключ
+// показывается один раз прямо в ответе на POST, без редиректа.
+func (h *APIKeyHandler) ListPage(w http.ResponseWriter, r *http.Request) {
+	u := user.CurrentUser(r.Context())
+	data := map[string]interface{}{"Scopes": Scopes}
+
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		days, _ := strconv.Atoi(r.FormValue("expires_days"))
+		k, plain, err := h.service.Create(r.Context(), u.ID, r.FormValue("name"), r.Form["scopes"], time.Duration(days)*24*time.Hour)
+		h.record(r, "apikey.create", k, err)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data["NewKey"] = plain
+		data["ClientID"] = k.ClientID()
+	}
+
+	keys, err := h.service.List(r.Context(), u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data["Keys"] = keys
+	h.templates.ExecuteTemplate(w, "api_keys.html", data)
+}
+
+func (h *APIKeyHandler) RevokePage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "invalid key ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.Revoke(r.Context(), id, user.CurrentUser(r.Context()).ID)
+	h.record(r, "apikey.revoke", &APIKey{ID: id}, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/api-keys", http.StatusSeeOther)
+}
+
+// TokenPage — точка выдачи токенов OAuth2 (RFC 6749, grant_type=client_credentials).
+// client_id и client_secret принимаются из Basic-авторизации или из формы.
+func (h *APIKeyHandler) TokenPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodPost {
+		tokenError(w, http.StatusMethodNotAllowed, "invalid_request")
+		return
+	}
+	if r.FormValue("grant_type") != "client_credentials" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.FormValue("client_id"), r.FormValue("client_secret")
+	}
+
+	token, scopes, err := h.service.IssueToken(r.Context(), clientID, secret, r.FormValue("scope"))
+	if err != nil {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": token,
+		"token_type":   "bearer",
+		"expires_in":   int(TokenTTL.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// record пишет выпуск и отзыв ключей в журнал аудита — без секрета
+func (h *APIKeyHandler) record(r *http.Request, action string, k *APIKey, opErr error) {
+	var targetID int
+	var after interface{}
+	if k != nil {
+		targetID = k.ID
+		if k.Name != "" {
+			after = map[string]interface{}{"name": k.Name, "client_id": k.ClientID(), "scopes": k.Scopes, "expires_at": k.ExpiresAt}
+		}
+	}
+
+	err := h.audit.Record(r.Context(), audit.ActorFromRequest(r, user.CurrentUser(r.Context()).ID), action, "api_key", targetID, nil, after, opErr)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "не удалось записать в журнал аудита", "action", action, "err", err)
+	}
+}
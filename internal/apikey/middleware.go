@@ -0,0 +1,84 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+
+	"online_bank/internal/logging"
+	"online_bank/internal/user"
+)
+
+type ctxKey int
+
+const principalKey ctxKey = iota
+
+// PrincipalFrom возвращает ключ, которым подписан запрос к API
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey).(*Principal)
+	return p
+}
+
+// Middleware пропускает запросы к API с Authorization: Bearer и кладёт владельца ключа
+// в контекст так же, как вход через форму, — обработчики читают его через user.CurrentUser
+type Middleware struct {
+	keys  *APIKeyService
+	users *user.UserService
+}
+
+func NewMiddleware(keys *APIKeyService, users *user.UserService) *Middleware {
+	return &Middleware{keys: keys, users: users}
+}
+
+// Require пропускает запрос, только если у ключа есть область scope
+func (m *Middleware) Require(next http.HandlerFunc, scope string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			unauthorized(w, "invalid_request", "missing bearer token")
+			return
+		}
+
+		p, err := m.keys.Authenticate(r.Context(), strings.TrimSpace(bearer), clientIP(r))
+		if err != nil {
+			unauthorized(w, "invalid_token", err.Error())
+			return
+		}
+		if !p.Has(scope) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+			writeError(w, http.StatusForbidden, "insufficient_scope: "+scope+" is required")
+			return
+		}
+
+		u, err := m.users.GetBalance(r.Context(), p.UserID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		logging.SetUserID(r.Context(), u.ID)
+		ctx := context.WithValue(user.WithUser(r.Context(), u), principalKey, p)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+func unauthorized(w http.ResponseWriter, code, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="`+code+`"`)
+	writeError(w, http.StatusUnauthorized, message)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
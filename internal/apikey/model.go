@@ -0,0 +1,60 @@
+package apikey
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	// ScopeRead — баланс и история операций
+	ScopeRead = "read"
+	// ScopeTransfer — переводы другим пользователям
+	ScopeTransfer = "transfer"
+)
+
+// Scopes — все области доступа в порядке показа
+var Scopes = []string{ScopeRead, ScopeTransfer}
+
+type APIKey struct {
+	ID         int
+	UserID     int
+	Name       string
+	Prefix     string
+	SecretHash string
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	RevokedAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	LastUsedIP string
+	CreatedAt  time.Time
+}
+
+// Active — ключ не отозван и не истёк
+func (k *APIKey) Active() bool {
+	return !k.RevokedAt.Valid && (!k.ExpiresAt.Valid || k.ExpiresAt.Time.After(time.Now()))
+}
+
+// ClientID — открытая часть ключа, она же client_id для OAuth2
+func (k *APIKey) ClientID() string {
+	return keyPrefix + k.Prefix
+}
+
+// Principal — кто обращается к API: владелец ключа и разрешённые области
+type Principal struct {
+	UserID int
+	KeyID  int
+	Scopes []string
+}
+
+func (p *Principal) Has(scope string) bool {
+	return hasScope(p.Scopes, scope)
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
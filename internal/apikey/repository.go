@@ -0,0 +1,160 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"online_bank/internal/timeouts"
+
+	"github.com/lib/pq"
+)
+
+type APIKeyRepository struct {
+	db       *sql.DB
+	timeouts timeouts.Config
+}
+
+func NewAPIKeyRepository(db *sql.DB, t timeouts.Config) *APIKeyRepository {
+	return &APIKeyRepository{db: db, timeouts: t}
+}
+
+func (r *APIKeyRepository) Create(ctx context.Context, k *APIKey) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "apikey.Create")
+	defer cancel()
+	k.CreatedAt = time.Now()
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (user_id, name, prefix, secret_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, k.UserID, k.Name, k.Prefix, k.SecretHash, pq.Array(k.Scopes), k.ExpiresAt, k.CreatedAt).Scan(&k.ID)
+}
+
+const columns = `id, user_id, name, prefix, secret_hash, scopes, expires_at, revoked_at, last_used_at, last_used_ip, created_at`
+
+func scanKey(row interface{ Scan(...interface{}) error }) (*APIKey, error) {
+	k := &APIKey{}
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.SecretHash, pq.Array(&k.Scopes),
+		&k.ExpiresAt, &k.RevokedAt, &k.LastUsedAt, &k.LastUsedIP, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (r *APIKeyRepository) ListByUser(ctx context.Context, userID int) ([]*APIKey, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "apikey.ListByUser")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `SELECT `+columns+` FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*APIKey
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, k)
+	}
+	return list, rows.Err()
+}
+
+func (r *APIKeyRepository) GetByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "apikey.GetByPrefix")
+	defer cancel()
+	k, err := scanKey(r.db.QueryRowContext(ctx, `SELECT `+columns+` FROM api_keys WHERE prefix = $1`, prefix))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("api key not found")
+	}
+	return k, err
+}
+
+func (r *APIKeyRepository) GetByID(ctx context.Context, id int) (*APIKey, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "apikey.GetByID")
+	defer cancel()
+	k, err := scanKey(r.db.QueryRowContext(ctx, `SELECT `+columns+` FROM api_keys WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("api key not found")
+	}
+	return k, err
+}
+
+// Revoke отзывает ключ пользователя вместе с выданными по нему токенами
+func (r *APIKeyRepository) Revoke(ctx context.Context, id, userID int) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "apikey.Revoke")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = $1
+		WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL
+	`, time.Now(), id, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n == 0 {
+		tx.Rollback()
+		return errors.New("api key not found")
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM api_access_tokens WHERE key_id = $1`, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// TouchLastUsed обновляет время и адрес последнего использования не чаще раза в минуту,
+// чтобы частые запросы не писали в базу каждый раз
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, id int, ip string) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "apikey.TouchLastUsed")
+	defer cancel()
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE api_keys SET last_used_at = $1, last_used_ip = $2
+		WHERE id = $3 AND (last_used_at IS NULL OR last_used_at < $4)
+	`, now, ip, id, now.Add(-time.Minute))
+	return err
+}
+
+// CreateToken сохраняет новый токен; истёкшие попутно удаляются
+func (r *APIKeyRepository) CreateToken(ctx context.Context, hash string, keyID int, scopes []string, expiresAt time.Time) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "apikey.CreateToken")
+	defer cancel()
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM api_access_tokens WHERE expires_at < $1`, time.Now()); err != nil {
+		return err
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO api_access_tokens (token_hash, key_id, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, hash, keyID, pq.Array(scopes), expiresAt, time.Now())
+	return err
+}
+
+// GetToken возвращает ключ и области действующего токена
+func (r *APIKeyRepository) GetToken(ctx context.Context, hash string) (keyID int, scopes []string, err error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "apikey.GetToken")
+	defer cancel()
+	err = r.db.QueryRowContext(ctx, `
+		SELECT key_id, scopes FROM api_access_tokens WHERE token_hash = $1 AND expires_at >= $2
+	`, hash, time.Now()).Scan(&keyID, pq.Array(&scopes))
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil, errors.New("invalid access token")
+	}
+	return keyID, scopes, err
+}
@@ -0,0 +1,181 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// Ключ целиком: obk_<prefix>_<secret>; client_id для OAuth2 — obk_<prefix>
+	keyPrefix = "obk_"
+	// Токен OAuth2: oat_<secret>
+	tokenPrefix = "oat_"
+	TokenTTL    = time.Hour
+)
+
+var errInvalidKey = errors.New("invalid api key")
+
+type APIKeyService struct {
+	repo *APIKeyRepository
+}
+
+func NewAPIKeyService(repo *APIKeyRepository) *APIKeyService {
+	return &APIKeyService{repo: repo}
+}
+
+// Create выпускает ключ и возвращает его целиком — это единственный раз,
+// когда секрет виден, в базе остаётся только хеш. ttl == 0 — бессрочный ключ.
+func (s *APIKeyService) Create(ctx context.Context, userID int, name string, scopes []string, ttl time.Duration) (*APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", errors.New("name is required")
+	}
+	if len(scopes) == 0 {
+		return nil, "", errors.New("at least one scope is required")
+	}
+	for _, sc := range scopes {
+		if !hasScope(Scopes, sc) {
+			return nil, "", errors.New("unknown scope " + sc)
+		}
+	}
+	if ttl < 0 {
+		return nil, "", errors.New("expiry must not be in the past")
+	}
+
+	prefix, err := randomString(6, hex.EncodeToString)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, "", err
+	}
+
+	k := &APIKey{
+		UserID:     userID,
+		Name:       name,
+		Prefix:     prefix,
+		SecretHash: hash(secret),
+		Scopes:     scopes,
+	}
+	if ttl > 0 {
+		k.ExpiresAt.Time, k.ExpiresAt.Valid = time.Now().Add(ttl), true
+	}
+	if err := s.repo.Create(ctx, k); err != nil {
+		return nil, "", err
+	}
+	return k, k.ClientID() + "_" + secret, nil
+}
+
+func (s *APIKeyService) List(ctx context.Context, userID int) ([]*APIKey, error) {
+	return s.repo.ListByUser(ctx, userID)
+}
+
+func (s *APIKeyService) Revoke(ctx context.Context, id, userID int) error {
+	return s.repo.Revoke(ctx, id, userID)
+}
+
+// Authenticate проверяет значение заголовка Authorization: Bearer — API-ключ
+// или токен OAuth2 — и отмечает использование ключа
+func (s *APIKeyService) Authenticate(ctx context.Context, bearer, ip string) (*Principal, error) {
+	var k *APIKey
+	var scopes []string
+
+	switch {
+	case strings.HasPrefix(bearer, tokenPrefix):
+		keyID, tokenScopes, err := s.repo.GetToken(ctx, hash(strings.TrimPrefix(bearer, tokenPrefix)))
+		if err != nil {
+			return nil, err
+		}
+		if k, err = s.repo.GetByID(ctx, keyID); err != nil {
+			return nil, err
+		}
+		scopes = tokenScopes
+	case strings.HasPrefix(bearer, keyPrefix):
+		prefix, secret, ok := strings.Cut(strings.TrimPrefix(bearer, keyPrefix), "_")
+		if !ok {
+			return nil, errInvalidKey
+		}
+		var err error
+		if k, err = s.verify(ctx, keyPrefix+prefix, secret); err != nil {
+			return nil, err
+		}
+		scopes = k.Scopes
+	default:
+		return nil, errInvalidKey
+	}
+
+	if !k.Active() {
+		return nil, errors.New("api key is revoked or expired")
+	}
+	if err := s.repo.TouchLastUsed(ctx, k.ID, ip); err != nil {
+		return nil, err
+	}
+	return &Principal{UserID: k.UserID, KeyID: k.ID, Scopes: scopes}, nil
+}
+
+// IssueToken — OAuth2 client credentials: обменивает client_id и client_secret ключа
+// на токен на TokenTTL. scope — запрошенные области через пробел, пусто — все области ключа.
+func (s *APIKeyService) IssueToken(ctx context.Context, clientID, clientSecret, scope string) (string, []string, error) {
+	k, err := s.verify(ctx, clientID, clientSecret)
+	if err != nil {
+		return "", nil, err
+	}
+	if !k.Active() {
+		return "", nil, errors.New("api key is revoked or expired")
+	}
+
+	scopes := k.Scopes
+	if requested := strings.Fields(scope); len(requested) > 0 {
+		for _, sc := range requested {
+			if !hasScope(k.Scopes, sc) {
+				return "", nil, errors.New("scope " + sc + " is not granted to this key")
+			}
+		}
+		scopes = requested
+	}
+
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.repo.CreateToken(ctx, hash(secret), k.ID, scopes, time.Now().Add(TokenTTL)); err != nil {
+		return "", nil, err
+	}
+	return tokenPrefix + secret, scopes, nil
+}
+
+func (s *APIKeyService) verify(ctx context.Context, clientID, secret string) (*APIKey, error) {
+	if !strings.HasPrefix(clientID, keyPrefix) {
+		return nil, errInvalidKey
+	}
+	k, err := s.repo.GetByPrefix(ctx, strings.TrimPrefix(clientID, keyPrefix))
+	if err != nil {
+		return nil, errInvalidKey
+	}
+	if subtle.ConstantTimeCompare([]byte(hash(secret)), []byte(k.SecretHash)) != 1 {
+		return nil, errInvalidKey
+	}
+	return k, nil
+}
+
+// hash — SHA-256 секрета. Секреты случайные и длинные, поэтому медленный bcrypt не нужен.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encode(b), nil
+}
@@ -0,0 +1,45 @@
+package audit
+
+import "time"
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+type Entry struct {
+	ID         int
+	ActorID    int
+	Action     string
+	TargetType string
+	TargetID   int
+	IP         string
+	UserAgent  string
+	// RequestID связывает запись с логами запроса; в хеш цепочки не входит
+	RequestID  string
+	Before     string
+	After      string
+	Outcome    string
+	Details    string
+	PrevHash   string
+	Hash       string
+	CreatedAt  time.Time
+}
+
+// Actor — кто и откуда совершил действие
+type Actor struct {
+	UserID    int
+	IP        string
+	UserAgent string
+	RequestID string
+}
+
+type Filter struct {
+	ActorID    int
+	Action     string
+	TargetType string
+	TargetID   int
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"online_bank/internal/timeouts"
+)
+
+type AuditRepository struct {
+	db       *sql.DB
+	timeouts timeouts.Config
+}
+
+func NewAuditRepository(db *sql.DB, t timeouts.Config) *AuditRepository {
+	return &AuditRepository{db: db, timeouts: t}
+}
+
+// Insert дописывает запись в конец цепочки. Таблица блокируется до коммита,
+// чтобы две записи не получили один и тот же prev_hash.
+func (r *AuditRepository) Insert(ctx context.Context, e *Entry) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "audit.Insert")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `LOCK TABLE audit_log IN SHARE ROW EXCLUSIVE MODE`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1`).Scan(&e.PrevHash)
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return err
+	}
+	e.Hash = computeHash(e)
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO audit_log (actor_id, action, target_type, target_id, ip, user_agent, request_id,
+			before_value, after_value, outcome, details, prev_hash, hash, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id
+	`, nullID(e.ActorID), e.Action, e.TargetType, nullID(e.TargetID), e.IP, e.UserAgent, e.RequestID,
+		e.Before, e.After, e.Outcome, e.Details, e.PrevHash, e.Hash, e.CreatedAt).Scan(&e.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *AuditRepository) Query(ctx context.Context, f Filter) ([]*Entry, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "audit.Query")
+	defer cancel()
+	var where []string
+	var args []interface{}
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.ActorID != 0 {
+		add("actor_id = $%d", f.ActorID)
+	}
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.TargetType != "" {
+		add("target_type = $%d", f.TargetType)
+	}
+	if f.TargetID != 0 {
+		add("target_id = $%d", f.TargetID)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created_at < $%d", f.To)
+	}
+
+	query := `SELECT ` + entryColumns + ` FROM audit_log`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit)
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanEntries(rows)
+}
+
+// All возвращает весь журнал по возрастанию id — для проверки цепочки
+func (r *AuditRepository) All(ctx context.Context) ([]*Entry, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "audit.All")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `SELECT ` + entryColumns + ` FROM audit_log ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanEntries(rows)
+}
+
+const entryColumns = `id, COALESCE(actor_id, 0), action, target_type, COALESCE(target_id, 0), ip, user_agent, request_id,
+	before_value, after_value, outcome, details, prev_hash, hash, created_at`
+
+func scanEntries(rows *sql.Rows) ([]*Entry, error) {
+	var entries []*Entry
+	for rows.Next() {
+		e := &Entry{}
+		err := rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.TargetType, &e.TargetID, &e.IP, &e.UserAgent, &e.RequestID,
+			&e.Before, &e.After, &e.Outcome, &e.Details, &e.PrevHash, &e.Hash, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"online_bank/internal/logging"
+)
+
+type AuditService struct {
+	repo *AuditRepository
+}
+
+func NewAuditService(repo *AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// ActorFromRequest собирает IP, User-Agent и идентификатор запроса для записи в журнал
+func ActorFromRequest(r *http.Request, userID int) Actor {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return Actor{UserID: userID, IP: ip, UserAgent: r.UserAgent(), RequestID: logging.RequestID(r.Context())}
+}
+
+// Record записывает действие actor над объектом targetType/targetID.
+// before и after сохраняются как JSON, opErr определяет исход операции.
+func (s *AuditService) Record(ctx context.Context, actor Actor, action, targetType string, targetID int, before, after interface{}, opErr error) error {
+	e := &Entry{
+		ActorID:    actor.UserID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         actor.IP,
+		UserAgent:  actor.UserAgent,
+		RequestID:  actor.RequestID,
+		Before:     toJSON(before),
+		After:      toJSON(after),
+		Outcome:    OutcomeSuccess,
+		// Postgres хранит микросекунды, иначе хеш после чтения не сойдётся
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	if opErr != nil {
+		e.Outcome = OutcomeFailure
+		e.Details = opErr.Error()
+	}
+	return s.repo.Insert(ctx, e)
+}
+
+func (s *AuditService) Query(ctx context.Context, f Filter) ([]*Entry, error) {
+	if f.Limit <= 0 || f.Limit > 500 {
+		f.Limit = 100
+	}
+	return s.repo.Query(ctx, f)
+}
+
+// Verify проходит по всей цепочке и возвращает id первой записи,
+// у которой хеш или ссылка на предыдущую запись не сходятся (0 — всё цело)
+func (s *AuditService) Verify(ctx context.Context) (int, error) {
+	entries, err := s.repo.All(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	prev := ""
+	for _, e := range entries {
+		// Записи, сделанные до появления цепочки, хеша не имеют
+		if e.Hash == "" && prev == "" {
+			continue
+		}
+		if e.PrevHash != prev || computeHash(e) != e.Hash {
+			return e.ID, nil
+		}
+		prev = e.Hash
+	}
+	return 0, nil
+}
+
+func computeHash(e *Entry) string {
+	fields := []string{
+		e.PrevHash,
+		strconv.Itoa(e.ActorID),
+		e.Action,
+		e.TargetType,
+		strconv.Itoa(e.TargetID),
+		e.IP,
+		e.UserAgent,
+		e.Before,
+		e.After,
+		e.Outcome,
+		e.Details,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+func toJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -6,6 +6,18 @@ import (
 	"net/http"
 )
 
+// Supported — валюты, для которых у пользователя есть отдельный баланс
+var Supported = []string{"TJS", "USD", "EUR"}
+
+func IsSupported(code string) bool {
+	for _, c := range Supported {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
 type RatesResponse struct {
 	Rates map[string]float64 `json:"rates"`
 }
@@ -13,11 +25,16 @@ type RatesResponse struct {
 
 func GetRate(from, to string, appID string) (float64, error) {
 	url := fmt.Sprintf(
-		"https://openexchangerates.org/api/latest.json?app_id=%s&symbols=%s,%s",
-		appID, from, to,
+		"https://openexchangerates.org/api/latest.json?symbols=%s,%s",
+		from, to,
 	)
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Token "+appID)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,127 @@
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"online_bank/internal/metrics"
+	"online_bank/internal/tracing"
+)
+
+// RateCache хранит курсы openexchangerates (к доллару) и обновляет их в фоне,
+// чтобы конвертация не ходила во внешний API на каждый запрос
+type RateCache struct {
+	appID  string
+	maxAge time.Duration
+	client *http.Client
+
+	mu        sync.RWMutex
+	rates     map[string]float64
+	updatedAt time.Time
+}
+
+// NewRateCache создаёт кеш; курсы старше maxAge считаются устаревшими
+func NewRateCache(appID string, maxAge time.Duration) *RateCache {
+	return &RateCache{
+		appID:  appID,
+		maxAge: maxAge,
+		client: &http.Client{Timeout: 10 * time.Second, Transport: tracing.Transport(nil)},
+	}
+}
+
+// Rate возвращает курс from → to. Устаревшие курсы сначала обновляются.
+func (c *RateCache) Rate(ctx context.Context, from, to string) (float64, error) {
+	if c.Check() != nil {
+		if err := c.Refresh(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	fromRate, ok1 := c.rates[from]
+	toRate, ok2 := c.rates[to]
+	if !ok1 || !ok2 {
+		return 0, fmt.Errorf("currency not found in API response")
+	}
+	return toRate / fromRate, nil
+}
+
+// Refresh загружает курсы всех поддерживаемых валют
+func (c *RateCache) Refresh(ctx context.Context) (err error) {
+	if c.appID == "" {
+		return errors.New("open exchange rates API key not set")
+	}
+	defer func(start time.Time) { metrics.ObserveRateFetch(start, err) }(time.Now())
+
+	url := "https://openexchangerates.org/api/latest.json?symbols=" + strings.Join(Supported, ",")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	// Ключ в заголовке, а не в адресе: адрес запроса попадает в спаны трассировки
+	req.Header.Set("Authorization", "Token "+c.appID)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rates API returned %s", resp.Status)
+	}
+
+	var data RatesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.rates = data.Rates
+	c.updatedAt = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// UpdatedAt — время последнего успешного обновления
+func (c *RateCache) UpdatedAt() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.updatedAt
+}
+
+// Check возвращает ошибку, если курсы не загружены или устарели — для /readyz
+func (c *RateCache) Check() error {
+	updated := c.UpdatedAt()
+	if updated.IsZero() {
+		return errors.New("rates not loaded")
+	}
+	if age := time.Since(updated); age > c.maxAge {
+		return fmt.Errorf("rates are %s old", age.Round(time.Second))
+	}
+	return nil
+}
+
+// Run обновляет курсы раз в interval, пока не отменён ctx
+func (c *RateCache) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.Refresh(ctx); err != nil {
+			slog.ErrorContext(ctx, "не удалось обновить курсы валют", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
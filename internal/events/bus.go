@@ -0,0 +1,132 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	// TypeBalance — у пользователя изменился баланс после проведённой операции
+	TypeBalance = "balance"
+	// TypeNotification — новое уведомление в приложении
+	TypeNotification = "notification"
+	// TypeNotify — уведомление, записанное в outbox вместе с операцией; в Data — Notice.
+	// До браузера доходит как TypeNotification после доставки notification.NotificationService.
+	TypeNotify = "notify"
+
+	// Проведённые операции приходят из outbox; в Data — запись из истории операций пользователя
+	TypeDeposit    = "deposit"
+	TypeTransfer   = "transfer"
+	TypeConversion = "conversion"
+	TypeReversal   = "reversal"
+	TypeRefund     = "refund"
+	TypeAdjustment = "adjustment"
+	TypeBonus      = "welcome_bonus"
+	// TypeFee — списание комиссии у плательщика, TypeFeeIncome — зачисление на счёт доходов
+	TypeFee       = "fee"
+	TypeFeeIncome = "fee_income"
+)
+
+// Event — событие для конкретного пользователя
+type Event struct {
+	ID       string             `json:"id"`
+	Type     string             `json:"type"`
+	UserID   int                `json:"-"`
+	Balances map[string]float64 `json:"balances,omitempty"`
+	Message  string             `json:"message,omitempty"`
+	Unread   int                `json:"unread,omitempty"`
+	Data     interface{}        `json:"data,omitempty"`
+	At       time.Time          `json:"at"`
+}
+
+// subscriberBuffer — сколько событий копится у медленного подписчика,
+// прежде чем новые начнут отбрасываться
+const subscriberBuffer = 16
+
+// Bus раздаёт события подписчикам одного процесса. Публикация не блокируется:
+// если подписчик не успевает читать, событие для него теряется,
+// а актуальный баланс он получит со следующим событием.
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[int]map[chan Event]struct{}
+	closed bool
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[int]map[chan Event]struct{}{}}
+}
+
+// Subscribe подписывает на события пользователя. Вызывающий обязан вызвать
+// возвращённую функцию отписки, после неё канал закрывается.
+func (b *Bus) Subscribe(userID int) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subs[userID] == nil {
+		b.subs[userID] = map[chan Event]struct{}{}
+	}
+	b.subs[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			// После Close канал уже закрыт
+			if _, ok := b.subs[userID][ch]; !ok {
+				return
+			}
+			delete(b.subs[userID], ch)
+			if len(b.subs[userID]) == 0 {
+				delete(b.subs, userID)
+			}
+			close(ch)
+		})
+	}
+}
+
+func (b *Bus) Publish(e Event) {
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subs[e.UserID] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Close закрывает каналы всех подписчиков, чтобы потоки /events завершились
+// при остановке сервера. Новые подписки сразу получают закрытый канал.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for _, chans := range b.subs {
+		for ch := range chans {
+			close(ch)
+		}
+	}
+	b.subs = map[int]map[chan Event]struct{}{}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
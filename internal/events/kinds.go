@@ -0,0 +1,18 @@
+package events
+
+// Виды событий, о которых уведомляется пользователь. Для каждого вида
+// пользователь сам выбирает каналы доставки.
+const (
+	KindTransferIn      = "transfer_in"
+	KindTransferOut     = "transfer_out"
+	KindAccount         = "account"
+	KindScheduledFailed = "scheduled_failed"
+	KindSecurity        = "security"
+)
+
+// Notice — уведомление пользователю о проведённой операции
+type Notice struct {
+	UserID  int    `json:"-"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,66 @@
+package fee
+
+import "math"
+
+const (
+	OpTransfer   = "transfer"
+	OpConversion = "conversion"
+
+	// RevenueAccountEmail — системный счёт, на который зачисляются комиссии
+	RevenueAccountEmail = "fees@online-bank.local"
+)
+
+// Rule — правило комиссии. Пустые Operation/From/To подходят под любое значение,
+// Min и Max ограничивают итоговую сумму (0 — без ограничения).
+type Rule struct {
+	Operation string  `json:"operation"`
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Flat      float64 `json:"flat"`
+	Percent   float64 `json:"percent"`
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+}
+
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Charge — комиссия, которую нужно списать с плательщика и зачислить на AccountID
+type Charge struct {
+	Amount    float64
+	AccountID int
+}
+
+type Engine struct {
+	rules []Rule
+}
+
+func NewEngine(cfg Config) *Engine {
+	return &Engine{rules: cfg.Rules}
+}
+
+// Calculate возвращает комиссию по первому подходящему правилу в валюте from
+func (e *Engine) Calculate(op, from, to string, amount float64) float64 {
+	for _, r := range e.rules {
+		if !r.matches(op, from, to) {
+			continue
+		}
+
+		fee := r.Flat + amount*r.Percent/100
+		if r.Min > 0 && fee < r.Min {
+			fee = r.Min
+		}
+		if r.Max > 0 && fee > r.Max {
+			fee = r.Max
+		}
+		return math.Round(fee*100) / 100
+	}
+	return 0
+}
+
+func (r Rule) matches(op, from, to string) bool {
+	return (r.Operation == "" || r.Operation == op) &&
+		(r.From == "" || r.From == from) &&
+		(r.To == "" || r.To == to)
+}
@@ -0,0 +1,110 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkTimeout ограничивает одну проверку, чтобы /readyz отвечал быстрее,
+// чем оркестратор сочтёт его зависшим
+const checkTimeout = 2 * time.Second
+
+// Check проверяет одну зависимость; nil — всё в порядке
+type Check func(ctx context.Context) error
+
+type component struct {
+	name  string
+	check Check
+}
+
+// Checker отвечает на /healthz и /readyz
+type Checker struct {
+	components   []component
+	shuttingDown atomic.Bool
+	started      time.Time
+}
+
+func NewChecker() *Checker {
+	return &Checker{started: time.Now()}
+}
+
+// Add регистрирует зависимость, без которой сервис не готов принимать запросы
+func (c *Checker) Add(name string, check Check) {
+	c.components = append(c.components, component{name: name, check: check})
+}
+
+// SetShuttingDown переводит /readyz в 503, чтобы балансировщик перестал слать запросы,
+// пока сервер дорабатывает текущие
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Status — состояние сервиса или одной зависимости
+type Status struct {
+	Status     string            `json:"status"`
+	Error      string            `json:"error,omitempty"`
+	DurationMS int64             `json:"duration_ms,omitempty"`
+	Uptime     string            `json:"uptime,omitempty"`
+	Components map[string]Status `json:"components,omitempty"`
+}
+
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+)
+
+// LivenessPage — /healthz: процесс жив и обрабатывает запросы.
+// Зависимости здесь не проверяются, иначе сбой БД приводил бы к перезапускам.
+func (c *Checker) LivenessPage(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, Status{Status: statusOK, Uptime: time.Since(c.started).Round(time.Second).String()})
+}
+
+// ReadinessPage — /readyz: все зависимости доступны и сервер не останавливается
+func (c *Checker) ReadinessPage(w http.ResponseWriter, r *http.Request) {
+	result := Status{Status: statusOK, Components: map[string]Status{}}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, comp := range c.components {
+		wg.Add(1)
+		go func(comp component) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			st := Status{Status: statusOK}
+			if err := comp.check(ctx); err != nil {
+				st = Status{Status: statusFail, Error: err.Error()}
+			}
+			st.DurationMS = time.Since(start).Milliseconds()
+
+			mu.Lock()
+			result.Components[comp.name] = st
+			if st.Status != statusOK {
+				result.Status = statusFail
+			}
+			mu.Unlock()
+		}(comp)
+	}
+	wg.Wait()
+
+	if c.shuttingDown.Load() {
+		result.Status = statusFail
+		result.Error = "shutting down"
+	}
+	writeStatus(w, result)
+}
+
+func writeStatus(w http.ResponseWriter, s Status) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if s.Status != statusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(s)
+}
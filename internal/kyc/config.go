@@ -0,0 +1,75 @@
+package kyc
+
+import (
+	"online_bank/internal/limits"
+	"online_bank/internal/user"
+)
+
+// DefaultWelcomeBonus — сколько TJS зачисляется при первом подтверждении личности
+const DefaultWelcomeBonus = 100.0
+
+// DefaultMaxDocumentMB — предельный размер файла документа
+const DefaultMaxDocumentMB = 5
+
+// DefaultDocumentDir — каталог файлов документов. Он не раздаётся сервером,
+// файлы отдаются только через админку.
+const DefaultDocumentDir = "kyc-documents"
+
+// DefaultLimits — лимиты по уровням, если в конфиге не заданы свои. Переводы и
+// конвертация без проверки запрещены сервисом, поэтому для unverified есть только пополнение;
+// у full ограничения задаёт лишь тариф.
+var DefaultLimits = limits.Policy{
+	user.KYCUnverified: {
+		"TJS": {MaxDeposit: 1000, DailyDeposit: 2000},
+	},
+	user.KYCBasic: {
+		"TJS": {MaxTransaction: 3000, DailyOutflow: 5000, MonthlyOutflow: 20000, MaxDeposit: 10000, DailyDeposit: 20000},
+		"USD": {MaxTransaction: 300, DailyOutflow: 500, MonthlyOutflow: 2000},
+		"EUR": {MaxTransaction: 300, DailyOutflow: 500, MonthlyOutflow: 2000},
+	},
+}
+
+// Config — проверка личности из config.json:
+//
+//	"kyc": {"welcome_bonus": 100, "max_document_mb": 5, "document_dir": "kyc-documents", "limits": {"basic": {"TJS": {...}}}}
+type Config struct {
+	// WelcomeBonus — бонус в TJS за первое подтверждение; не задан — 100, 0 — без бонуса
+	WelcomeBonus *float64 `json:"welcome_bonus"`
+	// MaxDocumentMB — размер одного файла; 0 — 5 МБ
+	MaxDocumentMB int `json:"max_document_mb"`
+	// DocumentDir — каталог документов вне uploads и static; пустой — DefaultDocumentDir
+	DocumentDir string `json:"document_dir"`
+	// Limits — уровень -> валюта -> лимит; не задан — DefaultLimits
+	Limits limits.Policy `json:"limits"`
+}
+
+// Bonus — приветственный бонус с учётом значения по умолчанию
+func (c Config) Bonus() float64 {
+	if c.WelcomeBonus == nil {
+		return DefaultWelcomeBonus
+	}
+	return *c.WelcomeBonus
+}
+
+// LimitPolicy — лимиты по уровням с учётом значений по умолчанию
+func (c Config) LimitPolicy() limits.Policy {
+	if c.Limits == nil {
+		return DefaultLimits
+	}
+	return c.Limits
+}
+
+func (c Config) maxDocumentSize() int64 {
+	mb := c.MaxDocumentMB
+	if mb <= 0 {
+		mb = DefaultMaxDocumentMB
+	}
+	return int64(mb) << 20
+}
+
+func (c Config) documentDir() string {
+	if c.DocumentDir == "" {
+		return DefaultDocumentDir
+	}
+	return c.DocumentDir
+}
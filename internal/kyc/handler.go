@@ -0,0 +1,193 @@
+package kyc
+
+import (
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+
+	"online_bank/internal/audit"
+	"online_bank/internal/user"
+)
+
+type KYCHandler struct {
+	service   *KYCService
+	audit     *audit.AuditService
+	templates *template.Template
+}
+
+func NewKYCHandler(service *KYCService, audit *audit.AuditService, templates *template.Template) *KYCHandler {
+	return &KYCHandler{service: service, audit: audit, templates: templates}
+}
+
+// levelOption — уровень, который пользователь может запросить
+type levelOption struct {
+	Level     string
+	Name      string
+	Documents []string
+}
+
+// Page — текущий уровень, форма загрузки документов и история заявок.
+// ?need=<уровень> приходит от RequireKYC и объясняет, почему открылась страница.
+func (h *KYCHandler) Page(w http.ResponseWriter, r *http.Request) {
+	u := user.CurrentUser(r.Context())
+
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, h.service.storage.maxSize*int64(len(RequiredDocuments[user.KYCFull]))+1<<20)
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, "invalid upload", http.StatusBadRequest)
+			return
+		}
+
+		files := map[string]io.Reader{}
+		for _, kind := range []string{DocPassport, DocSelfie} {
+			f, _, err := r.FormFile(kind)
+			if err != nil {
+				continue
+			}
+			defer f.Close()
+			files[kind] = f
+		}
+
+		sub, err := h.service.Submit(r.Context(), u, r.FormValue("level"), files)
+		h.record(r, "kyc.submit", sub, map[string]string{"level": r.FormValue("level")}, err)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "/kyc", http.StatusSeeOther)
+		return
+	}
+
+	history, err := h.service.History(r.Context(), u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pending := false
+	for _, sub := range history {
+		pending = pending || sub.Status == StatusPending
+	}
+
+	var options []levelOption
+	for _, level := range []string{user.KYCBasic, user.KYCFull} {
+		if !user.KYCAtLeast(u.KYCLevel, level) {
+			options = append(options, levelOption{Level: level, Name: levelName(level), Documents: RequiredDocuments[level]})
+		}
+	}
+
+	var need string
+	if _, ok := RequiredDocuments[r.FormValue("need")]; ok && !user.KYCAtLeast(u.KYCLevel, r.FormValue("need")) {
+		need = levelName(r.FormValue("need"))
+	}
+
+	h.templates.ExecuteTemplate(w, "kyc.html", map[string]interface{}{
+		"Level":     u.KYCLevel,
+		"LevelName": levelName(u.KYCLevel),
+		"Need":      need,
+		"Options":   options,
+		"Pending":   pending,
+		"History":   history,
+	})
+}
+
+// QueuePage — очередь заявок для сотрудников
+func (h *KYCHandler) QueuePage(w http.ResponseWriter, r *http.Request) {
+	queue, err := h.service.Queue(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.templates.ExecuteTemplate(w, "admin_kyc.html", map[string]interface{}{
+		"Submissions": queue,
+		"ReviewerID":  user.CurrentUser(r.Context()).ID,
+	})
+}
+
+func (h *KYCHandler) ApprovePage(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, "kyc.approve", func(id, reviewerID int) error {
+		return h.service.Approve(r.Context(), id, reviewerID)
+	})
+}
+
+func (h *KYCHandler) RejectPage(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, "kyc.reject", func(id, reviewerID int) error {
+		return h.service.Reject(r.Context(), id, reviewerID, r.FormValue("reason"))
+	})
+}
+
+func (h *KYCHandler) review(w http.ResponseWriter, r *http.Request, action string, decide func(id, reviewerID int) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := h.service.Get(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	err = decide(id, user.CurrentUser(r.Context()).ID)
+	h.record(r, action, sub, map[string]string{"level": sub.Level, "reason": r.FormValue("reason")}, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/admin/kyc", http.StatusSeeOther)
+}
+
+// DocumentPage отдаёт файл документа сотруднику. Каждый просмотр пишется в журнал аудита.
+func (h *KYCHandler) DocumentPage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "invalid ID", http.StatusBadRequest)
+		return
+	}
+	d, err := h.service.Document(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(d.Path)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "не удалось открыть документ", "document_id", d.ID, "err", err)
+		http.Error(w, "document file is missing", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	err = h.audit.Record(r.Context(), audit.ActorFromRequest(r, user.CurrentUser(r.Context()).ID), "kyc.document.view", "kyc_document", d.ID, nil,
+		map[string]interface{}{"submission_id": d.SubmissionID, "kind": d.Kind}, nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "не удалось записать в журнал аудита", "action", "kyc.document.view", "err", err)
+	}
+
+	w.Header().Set("Content-Type", d.ContentType)
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, "", d.CreatedAt, f)
+}
+
+// record пишет заявку и решение по ней в журнал аудита — без содержимого документов
+func (h *KYCHandler) record(r *http.Request, action string, sub *Submission, after interface{}, opErr error) {
+	var targetID int
+	var before interface{}
+	if sub != nil {
+		targetID = sub.ID
+		if sub.CurrentLevel != "" {
+			before = map[string]string{"level": sub.CurrentLevel, "user_id": strconv.Itoa(sub.UserID)}
+		}
+	}
+
+	err := h.audit.Record(r.Context(), audit.ActorFromRequest(r, user.CurrentUser(r.Context()).ID), action, "kyc_submission", targetID, before, after, opErr)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "не удалось записать в журнал аудита", "action", action, "err", err)
+	}
+}
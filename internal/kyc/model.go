@@ -0,0 +1,61 @@
+package kyc
+
+import (
+	"time"
+
+	"online_bank/internal/user"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// Виды документов
+const (
+	DocPassport = "passport"
+	DocSelfie   = "selfie"
+)
+
+// RequiredDocuments — какие документы нужны для уровня
+var RequiredDocuments = map[string][]string{
+	user.KYCBasic: {DocPassport},
+	user.KYCFull:  {DocPassport, DocSelfie},
+}
+
+// Submission — заявка на повышение уровня проверки личности
+type Submission struct {
+	ID       int
+	UserID   int
+	UserName string
+	// CurrentLevel — уровень пользователя сейчас, Level — запрошенный
+	CurrentLevel string
+	Level        string
+	Status       string
+	Reason       string
+	ReviewerID   int
+	CreatedAt    time.Time
+	ReviewedAt   time.Time
+	Documents    []*Document
+}
+
+type Document struct {
+	ID           int
+	SubmissionID int
+	Kind         string
+	Path         string
+	ContentType  string
+	CreatedAt    time.Time
+}
+
+func (s *Submission) LevelName() string        { return levelName(s.Level) }
+func (s *Submission) CurrentLevelName() string { return levelName(s.CurrentLevel) }
+
+// KindName — название документа для страниц
+func (d *Document) KindName() string {
+	if d.Kind == DocSelfie {
+		return "Селфи с паспортом"
+	}
+	return "Паспорт"
+}
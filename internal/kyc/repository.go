@@ -0,0 +1,259 @@
+package kyc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"online_bank/internal/pii"
+	"online_bank/internal/timeouts"
+
+	"github.com/lib/pq"
+)
+
+type KYCRepository struct {
+	db       *sql.DB
+	timeouts timeouts.Config
+	// pii расшифровывает имена пользователей
+	pii *pii.Cipher
+}
+
+func NewKYCRepository(db *sql.DB, t timeouts.Config, cipher *pii.Cipher) *KYCRepository {
+	return &KYCRepository{db: db, timeouts: t, pii: cipher}
+}
+
+const columns = `s.id, s.user_id, u.name, u.kyc_level, s.level, s.status, s.reason,
+	COALESCE(s.reviewer_id, 0), s.created_at, COALESCE(s.reviewed_at, s.created_at)`
+
+const joins = `kyc_submissions s JOIN users u ON u.id = s.user_id`
+
+// Create сохраняет заявку вместе с документами
+func (r *KYCRepository) Create(ctx context.Context, s *Submission) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "kyc.Create")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO kyc_submissions (user_id, level, status, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, s.UserID, s.Level, StatusPending, time.Now()).Scan(&s.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, d := range s.Documents {
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO kyc_documents (submission_id, kind, path, content_type, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		`, s.ID, d.Kind, d.Path, d.ContentType, time.Now()).Scan(&d.ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *KYCRepository) GetByID(ctx context.Context, id int) (*Submission, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "kyc.GetByID")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `SELECT `+columns+` FROM `+joins+` WHERE s.id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list, err := r.scanAll(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("kyc submission not found")
+	}
+	return list[0], nil
+}
+
+// ListForUser возвращает заявки пользователя, новые первыми
+func (r *KYCRepository) ListForUser(ctx context.Context, userID int) ([]*Submission, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "kyc.ListForUser")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+columns+` FROM `+joins+`
+		WHERE s.user_id = $1
+		ORDER BY s.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return r.scanAll(ctx, rows)
+}
+
+// Pending — очередь на проверку, старые заявки первыми
+func (r *KYCRepository) Pending(ctx context.Context) ([]*Submission, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "kyc.Pending")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+columns+` FROM `+joins+`
+		WHERE s.status = $1
+		ORDER BY s.created_at
+		LIMIT 100
+	`, StatusPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return r.scanAll(ctx, rows)
+}
+
+// Documents возвращает документы заявок по их id
+func (r *KYCRepository) Documents(ctx context.Context, submissionIDs []int) (map[int][]*Document, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "kyc.Documents")
+	defer cancel()
+	docs := map[int][]*Document{}
+	if len(submissionIDs) == 0 {
+		return docs, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, submission_id, kind, path, content_type, created_at
+		FROM kyc_documents
+		WHERE submission_id = ANY($1)
+		ORDER BY id
+	`, pq.Array(submissionIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := &Document{}
+		if err := rows.Scan(&d.ID, &d.SubmissionID, &d.Kind, &d.Path, &d.ContentType, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		docs[d.SubmissionID] = append(docs[d.SubmissionID], d)
+	}
+	return docs, rows.Err()
+}
+
+func (r *KYCRepository) GetDocument(ctx context.Context, id int) (*Document, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "kyc.GetDocument")
+	defer cancel()
+	d := &Document{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, submission_id, kind, path, content_type, created_at
+		FROM kyc_documents WHERE id = $1
+	`, id).Scan(&d.ID, &d.SubmissionID, &d.Kind, &d.Path, &d.ContentType, &d.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("document not found")
+	}
+	return d, err
+}
+
+// DocumentsIn возвращает документы, файлы которых лежат в каталоге dir
+func (r *KYCRepository) DocumentsIn(ctx context.Context, dir string) ([]*Document, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "kyc.DocumentsIn")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, submission_id, kind, path, content_type, created_at
+		FROM kyc_documents WHERE path LIKE $1
+		ORDER BY id
+	`, dir+"/%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []*Document
+	for rows.Next() {
+		d := &Document{}
+		if err := rows.Scan(&d.ID, &d.SubmissionID, &d.Kind, &d.Path, &d.ContentType, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		docs = append(docs, d)
+	}
+	return docs, rows.Err()
+}
+
+func (r *KYCRepository) SetDocumentPath(ctx context.Context, id int, path string) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "kyc.SetDocumentPath")
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `UPDATE kyc_documents SET path = $1 WHERE id = $2`, path, id)
+	return err
+}
+
+// Review закрывает заявку, если она ещё ждёт решения. При одобрении уровень
+// пользователя поднимается в той же транзакции и никогда не понижается, там же
+// выполняется onApprove (если задан). false — заявку уже рассмотрели.
+func (r *KYCRepository) Review(ctx context.Context, id, reviewerID int, status, reason string,
+	onApprove func(ctx context.Context, tx *sql.Tx, userID int, level string) error) (bool, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "kyc.Review")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	var userID int
+	var level string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE kyc_submissions
+		SET status = $1, reason = $2, reviewer_id = $3, reviewed_at = $4
+		WHERE id = $5 AND status = $6
+		RETURNING user_id, level
+	`, status, reason, reviewerID, time.Now(), id, StatusPending).Scan(&userID, &level)
+	if errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		return false, nil
+	}
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if status == StatusApproved {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE users SET kyc_level = $1
+			WHERE id = $2
+			  AND array_position(ARRAY['unverified', 'basic', 'full'], kyc_level)
+			    < array_position(ARRAY['unverified', 'basic', 'full'], $1::text)
+		`, level, userID)
+		if err != nil {
+			tx.Rollback()
+			return false, err
+		}
+		if onApprove != nil {
+			if err := onApprove(ctx, tx, userID, level); err != nil {
+				tx.Rollback()
+				return false, err
+			}
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+func (r *KYCRepository) scanAll(ctx context.Context, rows *sql.Rows) ([]*Submission, error) {
+	var list []*Submission
+	for rows.Next() {
+		s := &Submission{}
+		err := rows.Scan(&s.ID, &s.UserID, &s.UserName, &s.CurrentLevel, &s.Level, &s.Status, &s.Reason,
+			&s.ReviewerID, &s.CreatedAt, &s.ReviewedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.pii.DecryptAll(ctx, pii.Field{Column: pii.UserName, RowID: s.UserID, Value: &s.UserName}); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,201 @@
+package kyc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"online_bank/internal/events"
+	"online_bank/internal/outbox"
+	"online_bank/internal/user"
+)
+
+// Notifier сообщает пользователю о решении по заявке;
+// реализуется notification.NotificationService
+type Notifier interface {
+	Notify(ctx context.Context, userID int, kind, message string)
+}
+
+// BonusGranter зачисляет приветственный бонус; реализуется user.UserService
+type BonusGranter interface {
+	// GrantWelcomeBonus зачисляет бонус в транзакции tx вместе с уведомлением; true — зачислен сейчас
+	GrantWelcomeBonus(ctx context.Context, tx *sql.Tx, userID int, amount float64) (bool, error)
+}
+
+type KYCService struct {
+	repo     *KYCRepository
+	storage  *Storage
+	bonuses  BonusGranter
+	notifier Notifier
+	bonus    float64
+}
+
+func NewKYCService(repo *KYCRepository, cfg Config, bonuses BonusGranter, notifier Notifier) *KYCService {
+	return &KYCService{
+		repo:     repo,
+		storage:  NewStorage(cfg.documentDir(), cfg.maxDocumentSize()),
+		bonuses:  bonuses,
+		notifier: notifier,
+		bonus:    cfg.Bonus(),
+	}
+}
+
+// Submit сохраняет документы и ставит заявку на уровень level в очередь.
+// files — содержимое документов по видам из RequiredDocuments.
+func (s *KYCService) Submit(ctx context.Context, u *user.User, level string, files map[string]io.Reader) (*Submission, error) {
+	required, ok := RequiredDocuments[level]
+	if !ok {
+		return nil, errors.New("unknown verification level")
+	}
+	if user.KYCAtLeast(u.KYCLevel, level) {
+		return nil, errors.New("this verification level is already confirmed")
+	}
+
+	history, err := s.repo.ListForUser(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range history {
+		if sub.Status == StatusPending {
+			return nil, errors.New("previous submission is still under review")
+		}
+	}
+
+	sub := &Submission{UserID: u.ID, Level: level}
+	var paths []string
+	for _, kind := range required {
+		f, ok := files[kind]
+		if !ok {
+			s.storage.Remove(paths...)
+			return nil, fmt.Errorf("%s photo is required", kind)
+		}
+		path, contentType, err := s.storage.Save(f)
+		if err != nil {
+			s.storage.Remove(paths...)
+			return nil, fmt.Errorf("%s: %w", kind, err)
+		}
+		paths = append(paths, path)
+		sub.Documents = append(sub.Documents, &Document{Kind: kind, Path: path, ContentType: contentType})
+	}
+
+	if err := s.repo.Create(ctx, sub); err != nil {
+		s.storage.Remove(paths...)
+		return nil, err
+	}
+	return sub, nil
+}
+
+// MoveLegacyDocuments переносит в каталог документов файлы, сохранённые раньше
+// в раздаваемом uploads/kyc. Файл сначала копируется и записывается в базу, и только
+// потом удаляется, поэтому прерванный перенос можно просто запустить снова.
+func (s *KYCService) MoveLegacyDocuments(ctx context.Context) (int, error) {
+	docs, err := s.repo.DocumentsIn(ctx, legacyDocumentDir)
+	if err != nil {
+		return 0, err
+	}
+	for i, d := range docs {
+		path, err := s.storage.Adopt(d.Path)
+		if err != nil {
+			return i, fmt.Errorf("document %d: %w", d.ID, err)
+		}
+		if err := s.repo.SetDocumentPath(ctx, d.ID, path); err != nil {
+			return i, fmt.Errorf("document %d: %w", d.ID, err)
+		}
+		s.storage.Remove(d.Path)
+	}
+	return len(docs), nil
+}
+
+// History — заявки пользователя без документов
+func (s *KYCService) History(ctx context.Context, userID int) ([]*Submission, error) {
+	return s.repo.ListForUser(ctx, userID)
+}
+
+// Queue — заявки на проверке вместе с документами
+func (s *KYCService) Queue(ctx context.Context) ([]*Submission, error) {
+	list, err := s.repo.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, len(list))
+	for i, sub := range list {
+		ids[i] = sub.ID
+	}
+	docs, err := s.repo.Documents(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range list {
+		sub.Documents = docs[sub.ID]
+	}
+	return list, nil
+}
+
+func (s *KYCService) Get(ctx context.Context, id int) (*Submission, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *KYCService) Document(ctx context.Context, id int) (*Document, error) {
+	return s.repo.GetDocument(ctx, id)
+}
+
+// Approve подтверждает уровень из заявки и при первом подтверждении зачисляет
+// приветственный бонус. Бонус и уведомление пишутся в транзакции решения: если бонус
+// не прошёл, заявка остаётся на проверке и её можно одобрить снова.
+func (s *KYCService) Approve(ctx context.Context, id, reviewerID int) error {
+	_, err := s.review(ctx, id, reviewerID, StatusApproved, "", func(ctx context.Context, tx *sql.Tx, userID int, level string) error {
+		if _, err := s.bonuses.GrantWelcomeBonus(ctx, tx, userID, s.bonus); err != nil {
+			return err
+		}
+		return outbox.Notify(ctx, tx, events.Notice{UserID: userID, Kind: events.KindAccount, Message: "Личность подтверждена: уровень " + levelName(level)})
+	})
+	return err
+}
+
+func (s *KYCService) Reject(ctx context.Context, id, reviewerID int, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return errors.New("reason is required")
+	}
+	sub, err := s.review(ctx, id, reviewerID, StatusRejected, reason, nil)
+	if err != nil {
+		return err
+	}
+	s.notifier.Notify(ctx, sub.UserID, events.KindAccount, "Заявка на проверку личности отклонена: "+reason)
+	return nil
+}
+
+func (s *KYCService) review(ctx context.Context, id, reviewerID int, status, reason string,
+	onApprove func(ctx context.Context, tx *sql.Tx, userID int, level string) error) (*Submission, error) {
+	sub, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.UserID == reviewerID {
+		return nil, errors.New("cannot review your own submission")
+	}
+
+	ok, err := s.repo.Review(ctx, id, reviewerID, status, reason, onApprove)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("kyc submission is not pending")
+	}
+	return sub, nil
+}
+
+// levelName — название уровня для уведомлений и страниц
+func levelName(level string) string {
+	switch level {
+	case user.KYCBasic:
+		return "базовый"
+	case user.KYCFull:
+		return "полный"
+	}
+	return "без проверки"
+}
@@ -0,0 +1,84 @@
+package kyc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// legacyDocumentDir — каталог внутри раздаваемого uploads, где документы лежали раньше
+const legacyDocumentDir = "uploads/kyc"
+
+// allowedTypes — форматы фотографий документов и расширения файлов для них
+var allowedTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// Storage сохраняет файлы документов под случайными именами
+type Storage struct {
+	dir     string
+	maxSize int64
+}
+
+func NewStorage(dir string, maxSize int64) *Storage {
+	return &Storage{dir: dir, maxSize: maxSize}
+}
+
+// Save записывает файл и возвращает путь и тип содержимого. Тип определяется
+// по самому файлу, а не по имени и заголовкам формы.
+func (s *Storage) Save(src io.Reader) (string, string, error) {
+	data, err := io.ReadAll(io.LimitReader(src, s.maxSize+1))
+	if err != nil {
+		return "", "", err
+	}
+	if int64(len(data)) > s.maxSize {
+		return "", "", errors.New("document file is too large")
+	}
+	contentType := http.DetectContentType(data)
+	ext, ok := allowedTypes[contentType]
+	if !ok {
+		return "", "", errors.New("document must be a JPEG or PNG image")
+	}
+
+	name := make([]byte, 16)
+	if _, err := rand.Read(name); err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return "", "", err
+	}
+	path := filepath.Join(s.dir, hex.EncodeToString(name)+ext)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", "", err
+	}
+	return path, contentType, nil
+}
+
+// Adopt копирует в каталог хранилища файл, сохранённый в другом месте, под тем же именем
+// и возвращает новый путь. Исходный файл не удаляется.
+func (s *Storage) Adopt(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(s.dir, filepath.Base(path))
+	if err := os.WriteFile(dst, data, 0o600); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// Remove удаляет файлы заявки, которую не удалось сохранить
+func (s *Storage) Remove(paths ...string) {
+	for _, p := range paths {
+		os.Remove(p)
+	}
+}
@@ -0,0 +1,137 @@
+package limits
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Limit — ограничения для одной валюты. Ноль означает «без ограничения».
+type Limit struct {
+	MaxTransaction float64 `json:"max_transaction"`
+	DailyOutflow   float64 `json:"daily_outflow"`
+	MonthlyOutflow float64 `json:"monthly_outflow"`
+	MaxDeposit     float64 `json:"max_deposit"`
+	DailyDeposit   float64 `json:"daily_deposit"`
+}
+
+// Policy: тариф -> валюта -> лимит
+type Policy map[string]map[string]Limit
+
+func (p Policy) For(tier, currency string) Limit {
+	return p[tier][currency]
+}
+
+// Stricter объединяет два лимита: по каждому полю берётся меньшее ограничение
+func Stricter(a, b Limit) Limit {
+	return Limit{
+		MaxTransaction: stricter(a.MaxTransaction, b.MaxTransaction),
+		DailyOutflow:   stricter(a.DailyOutflow, b.DailyOutflow),
+		MonthlyOutflow: stricter(a.MonthlyOutflow, b.MonthlyOutflow),
+		MaxDeposit:     stricter(a.MaxDeposit, b.MaxDeposit),
+		DailyDeposit:   stricter(a.DailyDeposit, b.DailyDeposit),
+	}
+}
+
+func stricter(a, b float64) float64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// Usage — сколько уже израсходовано в текущие сутки и месяц
+type Usage struct {
+	DailyOutflow   float64
+	MonthlyOutflow float64
+	DailyDeposit   float64
+}
+
+type Status struct {
+	Currency string
+	Limit    Limit
+	Usage    Usage
+}
+
+func (s Status) DailyOutflowLeft() float64   { return left(s.Limit.DailyOutflow, s.Usage.DailyOutflow) }
+func (s Status) MonthlyOutflowLeft() float64 { return left(s.Limit.MonthlyOutflow, s.Usage.MonthlyOutflow) }
+func (s Status) DailyDepositLeft() float64   { return left(s.Limit.DailyDeposit, s.Usage.DailyDeposit) }
+
+// Querier — *sql.DB или *sql.Tx
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// GetUsage считает расход за сутки и месяц. В исходящие входят переводы и комиссии за них,
+// иначе комиссией можно было бы вывести деньги сверх лимита. Конвертация деньги со счёта
+// не выводит, поэтому ни она, ни комиссия за неё лимиты не расходуют.
+func GetUsage(ctx context.Context, q Querier, userID int, currency string) (Usage, error) {
+	now := time.Now()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	var u Usage
+	err := q.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(SUM(-t.amount) FILTER (WHERE t.type IN ('transfer', 'fee') AND t.amount < 0 AND c.id IS NULL AND t.created_at >= $3), 0),
+			COALESCE(SUM(-t.amount) FILTER (WHERE t.type IN ('transfer', 'fee') AND t.amount < 0 AND c.id IS NULL), 0),
+			COALESCE(SUM(t.amount) FILTER (WHERE t.type = 'deposit' AND t.created_at >= $3), 0)
+		FROM transactions t
+		LEFT JOIN transactions c ON c.id = t.fee_for AND c.type = 'conversion'
+		WHERE t.user_id = $1 AND t.currency = $2 AND t.created_at >= $4
+	`, userID, currency, dayStart, monthStart).Scan(&u.DailyOutflow, &u.MonthlyOutflow, &u.DailyDeposit)
+	return u, err
+}
+
+// CheckOutflow проверяет исходящий перевод; amount — вся списываемая сумма вместе с комиссией.
+// Вызывать внутри транзакции, в которой строка пользователя уже заблокирована FOR UPDATE.
+func CheckOutflow(ctx context.Context, q Querier, l Limit, userID int, currency string, amount float64) error {
+	if l.MaxTransaction > 0 && amount > l.MaxTransaction {
+		return fmt.Errorf("amount exceeds the single transaction limit of %.2f %s", l.MaxTransaction, currency)
+	}
+	if l.DailyOutflow == 0 && l.MonthlyOutflow == 0 {
+		return nil
+	}
+
+	u, err := GetUsage(ctx, q, userID, currency)
+	if err != nil {
+		return err
+	}
+	if l.DailyOutflow > 0 && u.DailyOutflow+amount > l.DailyOutflow {
+		return fmt.Errorf("daily transfer limit exceeded: %.2f %s left today", left(l.DailyOutflow, u.DailyOutflow), currency)
+	}
+	if l.MonthlyOutflow > 0 && u.MonthlyOutflow+amount > l.MonthlyOutflow {
+		return fmt.Errorf("monthly transfer limit exceeded: %.2f %s left this month", left(l.MonthlyOutflow, u.MonthlyOutflow), currency)
+	}
+	return nil
+}
+
+func CheckDeposit(ctx context.Context, q Querier, l Limit, userID int, currency string, amount float64) error {
+	if l.MaxDeposit > 0 && amount > l.MaxDeposit {
+		return fmt.Errorf("amount exceeds the single deposit limit of %.2f %s", l.MaxDeposit, currency)
+	}
+	if l.DailyDeposit == 0 {
+		return nil
+	}
+
+	u, err := GetUsage(ctx, q, userID, currency)
+	if err != nil {
+		return err
+	}
+	if u.DailyDeposit+amount > l.DailyDeposit {
+		return fmt.Errorf("daily deposit limit exceeded: %.2f %s left today", left(l.DailyDeposit, u.DailyDeposit), currency)
+	}
+	return nil
+}
+
+// left возвращает остаток лимита; -1 — лимита нет
+func left(limit, used float64) float64 {
+	if limit == 0 {
+		return -1
+	}
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
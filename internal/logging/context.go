@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	requestInfoKey
+)
+
+// requestInfo заполняется по ходу обработки запроса: пользователь становится
+// известен только после проверки входа, глубже по цепочке обработчиков
+type requestInfo struct {
+	userID   int
+	recorder *statusRecorder
+}
+
+// NewID возвращает случайный идентификатор запроса или запуска фоновой задачи
+func NewID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID кладёт идентификатор в контекст
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID возвращает идентификатор из контекста или пустую строку
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// SetUserID запоминает вошедшего пользователя для итоговой записи о запросе
+func SetUserID(ctx context.Context, userID int) {
+	if info := infoFrom(ctx); info != nil {
+		info.userID = userID
+	}
+}
+
+// Status — код ответа, уже отправленного обработчиками глубже по цепочке
+// (200, если код не задан явно). Вне logging.Middleware всегда 200.
+func Status(ctx context.Context) int {
+	if info := infoFrom(ctx); info != nil && info.recorder != nil {
+		return info.recorder.status
+	}
+	return http.StatusOK
+}
+
+func infoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey).(*requestInfo)
+	return info
+}
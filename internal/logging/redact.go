@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretKeys — атрибуты, значение которых не пишется никогда
+var secretKeys = []string{"password", "token", "secret", "authorization", "cookie", "api_key", "code"}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// API-ключи, токены OAuth2, заголовок Bearer и app_id из адреса API курсов
+	// могут попасть в текст ошибки
+	tokenPattern = regexp.MustCompile(`\b(obk|oat)_[A-Za-z0-9_\-]+|(?i:bearer)\s+\S+|app_id=[^&\s"]+`)
+)
+
+// redact — ReplaceAttr для slog: прячет секреты по имени атрибута
+// и маскирует email и токены внутри строк
+func redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, s := range secretKeys {
+		if strings.Contains(key, s) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Scrub(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Scrub(err.Error()))
+		}
+		if s, ok := a.Value.Any().(fmt.Stringer); ok {
+			return slog.String(a.Key, Scrub(s.String()))
+		}
+	}
+	return a
+}
+
+// Scrub маскирует в строке email-адреса и токены
+func Scrub(s string) string {
+	s = tokenPattern.ReplaceAllString(s, redacted)
+	return emailPattern.ReplaceAllStringFunc(s, MaskEmail)
+}
+
+// MaskEmail оставляет первую букву имени и домен: i***@mail.tj
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return redacted
+	}
+	return email[:1] + "***" + email[at:]
+}
@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer отправляет письмо одному получателю
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// Config — параметры SMTP из config.json. Пустой Host — письма только пишутся в лог.
+type Config struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+}
+
+func New(cfg Config) Mailer {
+	if cfg.Host == "" {
+		return LogMailer{}
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+	}
+	return &SMTPMailer{cfg: cfg}
+}
+
+type SMTPMailer struct {
+	cfg Config
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	// Адрес попадает в заголовки письма — переводы строк недопустимы
+	if strings.ContainsAny(to, "\r\n") {
+		return errors.New("invalid recipient address")
+	}
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	msg := "From: " + m.cfg.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body
+
+	addr := fmt.Sprintf("%s:%d", m.cfg.Host, m.cfg.Port)
+	return smtp.SendMail(addr, auth, m.cfg.From, []string{to}, []byte(msg))
+}
+
+// LogMailer пишет письма в лог — для разработки без SMTP-сервера
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	// Адрес маскируется логгером, текст письма пишется только на уровне debug
+	slog.Info("письмо", "to", to, "subject", subject)
+	slog.Debug("текст письма", "to", to, "body", body)
+	return nil
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry — собственный реестр, чтобы в /metrics попадало только то, что описано здесь
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Длительность HTTP-запросов по маршрутам.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	operations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bank_operations_total",
+		Help: "Проведённые операции по типу и валюте.",
+	}, []string{"operation", "currency"})
+
+	operationAmount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bank_operation_amount_total",
+		Help: "Сумма проведённых операций по типу и валюте.",
+	}, []string{"operation", "currency"})
+
+	transferFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bank_transfer_failures_total",
+		Help: "Отклонённые переводы по причине.",
+	}, []string{"reason"})
+
+	rateFetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bank_rate_fetch_duration_seconds",
+		Help:    "Длительность запросов курса валют к внешнему API.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"result"})
+
+	rateFetchErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "bank_rate_fetch_errors_total",
+		Help: "Неудачные запросы курса валют.",
+	})
+
+	rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_rate_limited_total",
+		Help: "Запросы, отклонённые ограничением частоты, по маршруту и ключу (ip или user).",
+	}, []string{"route", "key"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpDuration, operations, operationAmount, transferFailures,
+		rateFetchDuration, rateFetchErrors, rateLimited,
+	)
+}
+
+// Операции для ObserveOperation
+const (
+	OpDeposit    = "deposit"
+	OpTransfer   = "transfer"
+	OpConversion = "conversion"
+)
+
+// ObserveOperation учитывает проведённую операцию
+func ObserveOperation(op, currency string, amount float64) {
+	operations.WithLabelValues(op, currency).Inc()
+	operationAmount.WithLabelValues(op, currency).Add(amount)
+}
+
+// TransferFailed учитывает отклонённый перевод; reason — короткий код причины
+func TransferFailed(reason string) {
+	transferFailures.WithLabelValues(reason).Inc()
+}
+
+// ObserveRateFetch учитывает запрос курса, начатый в start
+func ObserveRateFetch(start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+		rateFetchErrors.Inc()
+	}
+	rateFetchDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// RateLimited учитывает запрос, отклонённый с 429
+func RateLimited(route, key string) {
+	rateLimited.WithLabelValues(route, key).Inc()
+}
+
+// RegisterDB добавляет статистику пула соединений (*sql.DB).Stats()
+func RegisterDB(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, "online_bank"))
+}
+
+// Handler отдаёт метрики. Если token не пуст, нужен заголовок Authorization: Bearer <token>.
+func Handler(token string) http.Handler {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return h
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
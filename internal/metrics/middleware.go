@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"online_bank/internal/logging"
+)
+
+// Middleware замеряет запросы. Метка route — шаблон, по которому ServeMux выбрал
+// обработчик, поэтому все файлы /uploads/... считаются вместе. Запросы без маршрута
+// попадают в "unmatched", чтобы сканеры не раздували число меток.
+// Статус берётся у logging.Middleware, поэтому этот middleware ставится внутри него.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+
+		// ServeMux записывает шаблон в Pattern того запроса, который получил
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		httpDuration.WithLabelValues(route, r.Method, strconv.Itoa(logging.Status(r.Context()))).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,89 @@
+package notification
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"online_bank/internal/user"
+)
+
+type NotificationHandler struct {
+	service   *NotificationService
+	templates *template.Template
+}
+
+func NewNotificationHandler(service *NotificationService, templates *template.Template) *NotificationHandler {
+	return &NotificationHandler{service: service, templates: templates}
+}
+
+func (h *NotificationHandler) ListPage(w http.ResponseWriter, r *http.Request) {
+	userID := user.CurrentUser(r.Context()).ID
+
+	list, err := h.service.List(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.templates.ExecuteTemplate(w, "notifications.html", list)
+}
+
+// ReadPage отмечает прочитанным одно уведомление (id) или все сразу
+func (h *NotificationHandler) ReadPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID := user.CurrentUser(r.Context()).ID
+
+	var err error
+	if r.FormValue("id") == "" {
+		err = h.service.MarkAllRead(r.Context(), userID)
+	} else {
+		id, convErr := strconv.Atoi(r.FormValue("id"))
+		if convErr != nil {
+			http.Error(w, "invalid notification ID", http.StatusBadRequest)
+			return
+		}
+		err = h.service.MarkRead(r.Context(), userID, id)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	back := "/notifications"
+	if r.FormValue("back") == "dashboard" {
+		back = "/dashboard"
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+func (h *NotificationHandler) SettingsPage(w http.ResponseWriter, r *http.Request) {
+	userID := user.CurrentUser(r.Context()).ID
+
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		prefs := make([]Preference, 0, len(Kinds))
+		for _, k := range Kinds {
+			prefs = append(prefs, Preference{
+				Kind:  k.Kind,
+				InApp: r.Form.Get(k.Kind+"_in_app") != "",
+				Email: r.Form.Get(k.Kind+"_email") != "",
+			})
+		}
+		if err := h.service.SavePreferences(r.Context(), userID, prefs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "/notifications/settings", http.StatusSeeOther)
+		return
+	}
+
+	prefs, err := h.service.Preferences(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.templates.ExecuteTemplate(w, "notification_settings.html", prefs)
+}
@@ -0,0 +1,48 @@
+package notification
+
+import (
+	"time"
+
+	"online_bank/internal/events"
+)
+
+type Notification struct {
+	ID        int
+	UserID    int
+	Kind      string
+	Message   string
+	Read      bool
+	CreatedAt time.Time
+}
+
+// Preference — каналы доставки одного вида уведомлений
+type Preference struct {
+	Kind  string
+	Title string
+	InApp bool
+	Email bool
+}
+
+// Kinds — все виды в порядке показа в настройках, с каналами по умолчанию
+var Kinds = []Preference{
+	{Kind: events.KindTransferIn, Title: "Входящие переводы и возвраты", InApp: true, Email: true},
+	{Kind: events.KindTransferOut, Title: "Исходящие переводы", InApp: true},
+	{Kind: events.KindAccount, Title: "Пополнения, конвертации, корректировки и отмены", InApp: true},
+	{Kind: events.KindScheduledFailed, Title: "Невыполненные регулярные платежи", InApp: true, Email: true},
+	{Kind: events.KindSecurity, Title: "Безопасность: входы и блокировка счёта", InApp: true, Email: true},
+}
+
+func defaultPreference(kind string) Preference {
+	for _, p := range Kinds {
+		if p.Kind == kind {
+			return p
+		}
+	}
+	return Preference{Kind: kind, InApp: true}
+}
+
+// Summary — колокольчик на главной: число непрочитанных и последние уведомления
+type Summary struct {
+	Unread int
+	Latest []*Notification
+}
@@ -0,0 +1,168 @@
+package notification
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"online_bank/internal/events"
+	"online_bank/internal/outbox"
+	"online_bank/internal/timeouts"
+)
+
+type NotificationRepository struct {
+	db       *sql.DB
+	timeouts timeouts.Config
+}
+
+func NewNotificationRepository(db *sql.DB, t timeouts.Config) *NotificationRepository {
+	return &NotificationRepository{db: db, timeouts: t}
+}
+
+// Deliver отмечает событие outbox eventID доставленным и в той же транзакции сохраняет n,
+// если пользователь получает такие уведомления в приложении (иначе n == nil).
+// Возвращает false, если событие уже было доставлено.
+func (r *NotificationRepository) Deliver(ctx context.Context, eventID string, n *Notification) (bool, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "notification.Deliver")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO notification_events (event_id) VALUES ($1)
+		ON CONFLICT (event_id) DO NOTHING
+	`, eventID)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	if n != nil {
+		n.CreatedAt = time.Now()
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO notifications (user_id, kind, message, created_at)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`, n.UserID, n.Kind, n.Message, n.CreatedAt).Scan(&n.ID)
+		if err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// Enqueue ставит уведомление в outbox отдельной транзакцией — для событий,
+// которые не связаны с проводкой денег
+func (r *NotificationRepository) Enqueue(ctx context.Context, n events.Notice) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "notification.Enqueue")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := outbox.Notify(ctx, tx, n); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// List возвращает последние limit уведомлений пользователя, новые первыми
+func (r *NotificationRepository) List(ctx context.Context, userID, limit int) ([]*Notification, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "notification.List")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, kind, message, read_at IS NOT NULL, created_at
+		FROM notifications
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*Notification
+	for rows.Next() {
+		n := &Notification{}
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &n.Message, &n.Read, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, n)
+	}
+	return list, rows.Err()
+}
+
+func (r *NotificationRepository) UnreadCount(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "notification.UnreadCount")
+	defer cancel()
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+// MarkRead отмечает прочитанным одно уведомление; id == 0 — все уведомления пользователя
+func (r *NotificationRepository) MarkRead(ctx context.Context, userID, id int) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "notification.MarkRead")
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE notifications SET read_at = $1
+		WHERE user_id = $2 AND read_at IS NULL AND ($3 = 0 OR id = $3)
+	`, time.Now(), userID, id)
+	return err
+}
+
+// Preferences возвращает сохранённые настройки пользователя по видам
+func (r *NotificationRepository) Preferences(ctx context.Context, userID int) (map[string]Preference, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "notification.Preferences")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `SELECT kind, in_app, email FROM notification_preferences WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs := map[string]Preference{}
+	for rows.Next() {
+		p := Preference{}
+		if err := rows.Scan(&p.Kind, &p.InApp, &p.Email); err != nil {
+			return nil, err
+		}
+		prefs[p.Kind] = p
+	}
+	return prefs, rows.Err()
+}
+
+func (r *NotificationRepository) SavePreferences(ctx context.Context, userID int, prefs []Preference) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "notification.SavePreferences")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range prefs {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO notification_preferences (user_id, kind, in_app, email)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, kind) DO UPDATE SET in_app = EXCLUDED.in_app, email = EXCLUDED.email
+		`, userID, p.Kind, p.InApp, p.Email)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
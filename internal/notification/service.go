@@ -0,0 +1,152 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"online_bank/internal/events"
+	"online_bank/internal/mailer"
+)
+
+// Recipients возвращает адрес почты пользователя; реализуется user.UserRepository
+type Recipients interface {
+	GetEmail(ctx context.Context, userID int) (string, error)
+}
+
+type NotificationService struct {
+	repo       *NotificationRepository
+	mailer     mailer.Mailer
+	recipients Recipients
+	events     *events.Bus
+}
+
+func NewNotificationService(repo *NotificationRepository, m mailer.Mailer, recipients Recipients, bus *events.Bus) *NotificationService {
+	return &NotificationService{repo: repo, mailer: m, recipients: recipients, events: bus}
+}
+
+// Notify ставит уведомление в outbox, доставит его Publish. Уведомления об операциях
+// с деньгами пишутся в транзакцию операции через outbox.Notify, а не сюда.
+// Ошибка только пишется в лог: уведомление не должно ломать само действие.
+func (s *NotificationService) Notify(ctx context.Context, userID int, kind, message string) {
+	if err := s.repo.Enqueue(ctx, events.Notice{UserID: userID, Kind: kind, Message: message}); err != nil {
+		slog.ErrorContext(ctx, "не удалось поставить уведомление в очередь", "user_id", userID, "err", err)
+	}
+}
+
+// Publish — получатель outbox.Relay: доставляет уведомления (events.TypeNotify) по каналам,
+// выбранным пользователем для этого вида, остальные события пропускает.
+// Повторно присланное событие не доставляется второй раз.
+func (s *NotificationService) Publish(ctx context.Context, e events.Event) error {
+	if e.Type != events.TypeNotify {
+		return nil
+	}
+	raw, _ := e.Data.(json.RawMessage)
+	var notice events.Notice
+	if err := json.Unmarshal(raw, &notice); err != nil {
+		return err
+	}
+
+	pref, err := s.preference(ctx, e.UserID, notice.Kind)
+	if err != nil {
+		return err
+	}
+	var n *Notification
+	if pref.InApp {
+		n = &Notification{UserID: e.UserID, Kind: notice.Kind, Message: notice.Message}
+	}
+	fresh, err := s.repo.Deliver(ctx, e.ID, n)
+	if err != nil || !fresh {
+		return err
+	}
+
+	if n != nil {
+		unread, _ := s.repo.UnreadCount(ctx, e.UserID)
+		s.events.Publish(events.Event{
+			Type:    events.TypeNotification,
+			UserID:  e.UserID,
+			Message: n.Message,
+			Unread:  unread,
+		})
+	}
+	if pref.Email {
+		// Письмо уходит в фоне, чтобы медленный SMTP не задерживал остальные события
+		go s.email(context.WithoutCancel(ctx), e.UserID, notice.Message)
+	}
+	return nil
+}
+
+// email отправляет письмо в фоне, поэтому остановка relay его не прерывает
+func (s *NotificationService) email(ctx context.Context, userID int, message string) {
+	to, err := s.recipients.GetEmail(ctx, userID)
+	if err == nil {
+		err = s.mailer.Send(to, "Уведомление от банка", message)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "не удалось отправить письмо", "user_id", userID, "err", err)
+	}
+}
+
+func (s *NotificationService) preference(ctx context.Context, userID int, kind string) (Preference, error) {
+	prefs, err := s.repo.Preferences(ctx, userID)
+	if err != nil {
+		return defaultPreference(kind), err
+	}
+	if p, ok := prefs[kind]; ok {
+		return p, nil
+	}
+	return defaultPreference(kind), nil
+}
+
+func (s *NotificationService) List(ctx context.Context, userID int) ([]*Notification, error) {
+	return s.repo.List(ctx, userID, 100)
+}
+
+// Summary — данные для колокольчика на главной
+func (s *NotificationService) Summary(ctx context.Context, userID int) (*Summary, error) {
+	unread, err := s.repo.UnreadCount(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := s.repo.List(ctx, userID, 5)
+	if err != nil {
+		return nil, err
+	}
+	return &Summary{Unread: unread, Latest: latest}, nil
+}
+
+func (s *NotificationService) MarkRead(ctx context.Context, userID, id int) error {
+	return s.repo.MarkRead(ctx, userID, id)
+}
+
+func (s *NotificationService) MarkAllRead(ctx context.Context, userID int) error {
+	return s.repo.MarkRead(ctx, userID, 0)
+}
+
+// Preferences возвращает настройки всех видов, подставляя значения по умолчанию
+func (s *NotificationService) Preferences(ctx context.Context, userID int) ([]Preference, error) {
+	saved, err := s.repo.Preferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs := make([]Preference, 0, len(Kinds))
+	for _, def := range Kinds {
+		p := def
+		if got, ok := saved[def.Kind]; ok {
+			p.InApp, p.Email = got.InApp, got.Email
+		}
+		prefs = append(prefs, p)
+	}
+	return prefs, nil
+}
+
+func (s *NotificationService) SavePreferences(ctx context.Context, userID int, prefs []Preference) error {
+	for _, p := range prefs {
+		if defaultPreference(p.Kind).Title == "" {
+			return errors.New("unknown notification kind")
+		}
+	}
+	return s.repo.SavePreferences(ctx, userID, prefs)
+}
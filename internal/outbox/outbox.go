@@ -0,0 +1,61 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"online_bank/internal/events"
+)
+
+// Message — строка outbox
+type Message struct {
+	ID        int64
+	EventID   string
+	Type      string
+	UserID    int
+	Payload   json.RawMessage
+	CreatedAt time.Time
+	Attempts  int
+	LastError string
+}
+
+// Event — событие для подписчиков; EventID одинаков при всех повторах,
+// по нему получатели отбрасывают дубликаты
+func (m *Message) Event() events.Event {
+	return events.Event{
+		ID:     m.EventID,
+		Type:   m.Type,
+		UserID: m.UserID,
+		At:     m.CreatedAt,
+		Data:   m.Payload,
+	}
+}
+
+// Insert добавляет событие в outbox в переданной транзакции. Вызывается до tx.Commit():
+// если транзакция откатится, события не будет.
+func Insert(ctx context.Context, tx *sql.Tx, eventType string, userID int, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO outbox (event_id, event_type, user_id, payload, created_at, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+	`, newEventID(), eventType, userID, string(payload), time.Now())
+	return err
+}
+
+// Notify ставит уведомление в outbox в транзакции tx — вместе с операцией, о которой оно
+func Notify(ctx context.Context, tx *sql.Tx, n events.Notice) error {
+	return Insert(ctx, tx, events.TypeNotify, n.UserID, n)
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
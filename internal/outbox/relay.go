@@ -0,0 +1,107 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"online_bank/internal/events"
+	"online_bank/internal/logging"
+)
+
+const (
+	claimLease = time.Minute
+	batchSize  = 100
+	// Пауза после неудачи растёт вдвое с каждой попыткой, но не больше maxBackoff
+	baseBackoff = 5 * time.Second
+	maxBackoff  = 10 * time.Minute
+	// Отправленные сообщения хранятся неделю — для разбора инцидентов
+	retention = 7 * 24 * time.Hour
+)
+
+// Sink принимает события из outbox. Ошибка означает, что событие будет отправлено
+// повторно — всем получателям, поэтому получатели должны отбрасывать дубликаты по Event.ID.
+type Sink interface {
+	Publish(ctx context.Context, e events.Event) error
+}
+
+// Relay переносит события из outbox в получателей
+type Relay struct {
+	repo  *OutboxRepository
+	sinks []Sink
+}
+
+func NewRelay(repo *OutboxRepository, sinks ...Sink) *Relay {
+	return &Relay{repo: repo, sinks: sinks}
+}
+
+// Run раз в interval отправляет накопившиеся события, пока не отменён ctx.
+// Порядок соблюдается внутри пачки; сообщение, ожидающее повтора, не задерживает следующие.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+
+	for {
+		now := time.Now()
+		// Остановка не обрывает пачку на середине, запросы ограничены таймаутами БД
+		tick := logging.WithRequestID(context.WithoutCancel(ctx), logging.NewID())
+		r.relay(tick, now)
+
+		if now.Sub(lastPurge) > time.Hour {
+			if _, err := r.repo.Purge(tick, now.Add(-retention)); err != nil {
+				slog.ErrorContext(tick, "не удалось очистить outbox", "err", err)
+			}
+			lastPurge = now
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Relay) relay(ctx context.Context, now time.Time) {
+	messages, err := r.repo.Claim(ctx, now, claimLease, batchSize)
+	if err != nil {
+		slog.ErrorContext(ctx, "не удалось получить события из outbox", "err", err)
+		return
+	}
+
+	for _, m := range messages {
+		if err := r.publish(ctx, m.Event()); err != nil {
+			m.Attempts++
+			slog.WarnContext(ctx, "не удалось отправить событие", "event_id", m.EventID, "attempt", m.Attempts, "err", err)
+			if err := r.repo.MarkFailed(ctx, m.ID, m.Attempts, time.Now().Add(backoff(m.Attempts)), err.Error()); err != nil {
+				slog.ErrorContext(ctx, "не удалось сохранить ошибку события", "event_id", m.EventID, "err", err)
+			}
+			continue
+		}
+		if err := r.repo.MarkPublished(ctx, m.ID); err != nil {
+			slog.ErrorContext(ctx, "не удалось отметить событие отправленным", "event_id", m.EventID, "err", err)
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, e events.Event) error {
+	for _, s := range r.sinks {
+		if err := s.Publish(ctx, e); err != nil {
+			return fmt.Errorf("%T: %v", s, err)
+		}
+	}
+	return nil
+}
+
+func backoff(attempts int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
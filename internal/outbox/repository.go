@@ -0,0 +1,82 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"online_bank/internal/timeouts"
+)
+
+type OutboxRepository struct {
+	db       *sql.DB
+	timeouts timeouts.Config
+}
+
+func NewOutboxRepository(db *sql.DB, t timeouts.Config) *OutboxRepository {
+	return &OutboxRepository{db: db, timeouts: t}
+}
+
+// Claim забирает до limit неотправленных сообщений по порядку и откладывает их на lease,
+// чтобы второй экземпляр реле не взял их одновременно. Если процесс упадёт,
+// сообщения вернутся в работу по истечении lease.
+func (r *OutboxRepository) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Message, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "outbox.Claim")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE outbox SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE published_at IS NULL AND next_attempt_at <= $1
+			ORDER BY id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, event_id, event_type, user_id, payload, created_at, attempts
+	`, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*Message
+	for rows.Next() {
+		m := &Message{}
+		var payload string
+		if err := rows.Scan(&m.ID, &m.EventID, &m.Type, &m.UserID, &payload, &m.CreatedAt, &m.Attempts); err != nil {
+			return nil, err
+		}
+		m.Payload = []byte(payload)
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+func (r *OutboxRepository) MarkPublished(ctx context.Context, id int64) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "outbox.MarkPublished")
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `UPDATE outbox SET published_at = $1, last_error = '' WHERE id = $2`, time.Now(), id)
+	return err
+}
+
+// MarkFailed записывает ошибку и время следующей попытки
+func (r *OutboxRepository) MarkFailed(ctx context.Context, id int64, attempts int, next time.Time, lastError string) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "outbox.MarkFailed")
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE outbox SET attempts = $1, next_attempt_at = $2, last_error = $3
+		WHERE id = $4
+	`, attempts, next, lastError, id)
+	return err
+}
+
+// Purge удаляет отправленные сообщения старше before
+func (r *OutboxRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "outbox.Purge")
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, `DELETE FROM outbox WHERE published_at IS NOT NULL AND published_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,98 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"online_bank/internal/events"
+)
+
+// BusSink передаёт события шине процесса — оттуда они уходят в браузеры через /events
+type BusSink struct {
+	Bus *events.Bus
+}
+
+func (s BusSink) Publish(ctx context.Context, e events.Event) error {
+	switch e.Type {
+	case events.TypeNotify:
+		// В браузер уведомление отправляет notification.NotificationService — уже с числом непрочитанных
+		return nil
+	case events.TypeBalance:
+		// Страница читает балансы из поля balances
+		if raw, ok := e.Data.(json.RawMessage); ok {
+			if err := json.Unmarshal(raw, &e.Balances); err != nil {
+				return err
+			}
+			e.Data = nil
+		}
+	}
+	s.Bus.Publish(e)
+	return nil
+}
+
+// message — событие в том виде, в каком оно уходит во внешние брокеры
+type message struct {
+	ID     string      `json:"id"`
+	Type   string      `json:"type"`
+	UserID int         `json:"user_id"`
+	At     time.Time   `json:"created_at"`
+	Data   interface{} `json:"data"`
+}
+
+// localOnly — события для страниц самого банка: балансы и тексты уведомлений
+// во внешние брокеры не отправляются
+func localOnly(e events.Event) bool {
+	return e.Type == events.TypeBalance || e.Type == events.TypeNotify
+}
+
+func encode(e events.Event) ([]byte, error) {
+	return json.Marshal(message{ID: e.ID, Type: e.Type, UserID: e.UserID, At: e.At, Data: e.Data})
+}
+
+// NATSPublisher — то, что нужно от клиента NATS; *nats.Conn подходит как есть
+type NATSPublisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// NATSSink публикует событие в subject Prefix + "." + тип, например "bank.events.transfer".
+// Core NATS не отбрасывает дубликаты — подписчики делают это по полю id.
+type NATSSink struct {
+	Conn   NATSPublisher
+	Prefix string
+}
+
+func (s NATSSink) Publish(ctx context.Context, e events.Event) error {
+	if localOnly(e) {
+		return nil
+	}
+	data, err := encode(e)
+	if err != nil {
+		return err
+	}
+	return s.Conn.Publish(s.Prefix+"."+e.Type, data)
+}
+
+// KafkaProducer — минимальная обёртка над клиентом Kafka: синхронная запись одного сообщения
+type KafkaProducer interface {
+	Produce(topic string, key, value []byte) error
+}
+
+// KafkaSink пишет события в Topic с ключом user_id: события одного пользователя
+// попадают в одну партицию и читаются по порядку
+type KafkaSink struct {
+	Producer KafkaProducer
+	Topic    string
+}
+
+func (s KafkaSink) Publish(ctx context.Context, e events.Event) error {
+	if localOnly(e) {
+		return nil
+	}
+	data, err := encode(e)
+	if err != nil {
+		return err
+	}
+	return s.Producer.Produce(s.Topic, []byte(strconv.Itoa(e.UserID)), data)
+}
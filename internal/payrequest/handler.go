@@ -0,0 +1,120 @@
+package payrequest
+
+import (
+	"context"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"online_bank/internal/audit"
+	"online_bank/internal/user"
+)
+
+type PaymentRequestHandler struct {
+	service   *PaymentRequestService
+	users     *user.UserService
+	audit     *audit.AuditService
+	templates *template.Template
+}
+
+func NewPaymentRequestHandler(service *PaymentRequestService, users *user.UserService, audit *audit.AuditService, templates *template.Template) *PaymentRequestHandler {
+	return &PaymentRequestHandler{service: service, users: users, audit: audit, templates: templates}
+}
+
+func (h *PaymentRequestHandler) ListPage(w http.ResponseWriter, r *http.Request) {
+	userID := user.CurrentUser(r.Context()).ID
+
+	if r.Method == http.MethodPost {
+		payerID, err := strconv.Atoi(r.FormValue("payer_id"))
+		if err != nil {
+			http.Error(w, "invalid payer ID", http.StatusBadRequest)
+			return
+		}
+		amount, err := strconv.ParseFloat(r.FormValue("amount"), 64)
+		if err != nil {
+			http.Error(w, "invalid amount", http.StatusBadRequest)
+			return
+		}
+		days, err := strconv.Atoi(r.FormValue("expires_days"))
+		if err != nil {
+			http.Error(w, "invalid expiry", http.StatusBadRequest)
+			return
+		}
+
+		err = h.service.Create(r.Context(), userID, payerID, amount, r.FormValue("currency"), r.FormValue("note"), time.Duration(days)*24*time.Hour)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "/requests", http.StatusSeeOther)
+		return
+	}
+
+	list, err := h.service.List(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	users, err := h.users.GetAllUsersExcept(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.templates.ExecuteTemplate(w, "requests.html", map[string]interface{}{
+		"UserID":   userID,
+		"Requests": list,
+		"Users":    users,
+	})
+}
+
+func (h *PaymentRequestHandler) ApprovePage(w http.ResponseWriter, r *http.Request) {
+	h.act(w, r, "payrequest.approve", StatusApproved, h.service.Approve)
+}
+
+func (h *PaymentRequestHandler) DeclinePage(w http.ResponseWriter, r *http.Request) {
+	h.act(w, r, "payrequest.decline", StatusDeclined, func(ctx context.Context, id, userID int) error {
+		return h.service.Decline(ctx, id, userID, r.FormValue("reason"))
+	})
+}
+
+func (h *PaymentRequestHandler) CancelPage(w http.ResponseWriter, r *http.Request) {
+	h.act(w, r, "payrequest.cancel", StatusCancelled, h.service.Cancel)
+}
+
+// act выполняет действие над запросом, пишет его в журнал аудита
+// и возвращает на страницу, с которой пришли
+func (h *PaymentRequestHandler) act(w http.ResponseWriter, r *http.Request, name, status string, action func(ctx context.Context, id, userID int) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	err = action(r.Context(), id, user.CurrentUser(r.Context()).ID)
+	h.record(r, name, id, map[string]string{"status": status, "reason": r.FormValue("reason")}, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	back := "/requests"
+	if r.FormValue("back") == "dashboard" {
+		back = "/dashboard"
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+func (h *PaymentRequestHandler) record(r *http.Request, action string, id int, after interface{}, opErr error) {
+	err := h.audit.Record(r.Context(), audit.ActorFromRequest(r, user.CurrentUser(r.Context()).ID), action, "payment_request", id, nil, after, opErr)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "не удалось записать в журнал аудита", "action", action, "err", err)
+	}
+}
@@ -0,0 +1,35 @@
+package payrequest
+
+import "time"
+
+const (
+	StatusPending   = "pending"
+	StatusApproved  = "approved"
+	StatusDeclined  = "declined"
+	StatusCancelled = "cancelled"
+	StatusExpired   = "expired"
+	// StatusFailed пишется только в историю: после неудачной оплаты запрос снова ждёт ответа
+	StatusFailed = "failed"
+)
+
+type PaymentRequest struct {
+	ID            int
+	RequesterID   int
+	RequesterName string
+	PayerID       int
+	PayerName     string
+	Amount        float64
+	Currency      string
+	Note          string
+	Status        string
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+	History       []*Event
+}
+
+type Event struct {
+	Status    string
+	ActorID   int
+	Note      string
+	CreatedAt time.Time
+}
@@ -0,0 +1,250 @@
+package payrequest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"online_bank/internal/pii"
+	"online_bank/internal/timeouts"
+
+	"github.com/lib/pq"
+)
+
+type PaymentRequestRepository struct {
+	db       *sql.DB
+	timeouts timeouts.Config
+	// pii расшифровывает имена пользователей
+	pii *pii.Cipher
+}
+
+func NewPaymentRequestRepository(db *sql.DB, t timeouts.Config, cipher *pii.Cipher) *PaymentRequestRepository {
+	return &PaymentRequestRepository{db: db, timeouts: t, pii: cipher}
+}
+
+func (r *PaymentRequestRepository) Create(ctx context.Context, p *PaymentRequest) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "payrequest.Create")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO payment_requests (requester_id, payer_id, amount, currency, note, status, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		RETURNING id
+	`, p.RequesterID, p.PayerID, p.Amount, p.Currency, p.Note, StatusPending, p.ExpiresAt, time.Now()).Scan(&p.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := insertEvent(ctx, tx, p.ID, StatusPending, p.RequesterID, ""); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PaymentRequestRepository) GetByID(ctx context.Context, id int) (*PaymentRequest, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "payrequest.GetByID")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `SELECT `+columns+` FROM `+joins+` WHERE p.id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list, err := r.scanAll(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("payment request not found")
+	}
+	return list[0], nil
+}
+
+// ListForUser возвращает запросы, где пользователь — получатель или плательщик
+func (r *PaymentRequestRepository) ListForUser(ctx context.Context, userID int) ([]*PaymentRequest, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "payrequest.ListForUser")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+columns+` FROM `+joins+`
+		WHERE p.requester_id = $1 OR p.payer_id = $1
+		ORDER BY p.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return r.scanAll(ctx, rows)
+}
+
+func (r *PaymentRequestRepository) PendingForPayer(ctx context.Context, payerID int) ([]*PaymentRequest, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "payrequest.PendingForPayer")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+columns+` FROM `+joins+`
+		WHERE p.payer_id = $1 AND p.status = $2 AND p.expires_at > $3
+		ORDER BY p.created_at
+	`, payerID, StatusPending, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return r.scanAll(ctx, rows)
+}
+
+// History возвращает историю статусов для набора запросов
+func (r *PaymentRequestRepository) History(ctx context.Context, ids []int) (map[int][]*Event, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "payrequest.History")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT request_id, status, COALESCE(actor_id, 0), note, created_at
+		FROM payment_request_events
+		WHERE request_id = ANY($1)
+		ORDER BY id
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := map[int][]*Event{}
+	for rows.Next() {
+		var id int
+		e := &Event{}
+		if err := rows.Scan(&id, &e.Status, &e.ActorID, &e.Note, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		history[id] = append(history[id], e)
+	}
+	return history, rows.Err()
+}
+
+// ChangeStatus атомарно переводит запрос из статуса from в to и пишет событие в историю.
+// Возвращает false, если запрос уже не в статусе from (или чужой).
+func (r *PaymentRequestRepository) ChangeStatus(ctx context.Context, id int, from, to string, actorID int, ownerColumn, note string) (bool, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "payrequest.ChangeStatus")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE payment_requests SET status = $1, updated_at = $2
+		WHERE id = $3 AND status = $4 AND `+ownerColumn+` = $5
+	`, to, time.Now(), id, from, actorID)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if n == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	if err := insertEvent(ctx, tx, id, to, actorID, note); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// errNotPending — запрос уже оплачен, отклонён, отменён или просрочен
+var errNotPending = errors.New("payment request is not pending")
+
+// Approve помечает запрос оплаченным в транзакции перевода tx. Если запрос уже не ждёт
+// оплаты или просрочен, возвращает errNotPending, и перевод откатывается.
+func (r *PaymentRequestRepository) Approve(ctx context.Context, tx *sql.Tx, id, payerID int) error {
+	now := time.Now()
+	res, err := tx.ExecContext(ctx, `
+		UPDATE payment_requests SET status = $1, updated_at = $2
+		WHERE id = $3 AND status = $4 AND payer_id = $5 AND expires_at > $2
+	`, StatusApproved, now, id, StatusPending, payerID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNotPending
+	}
+	return insertEvent(ctx, tx, id, StatusApproved, payerID, "")
+}
+
+// AddEvent пишет событие без смены статуса (например, неудачная попытка оплаты)
+func (r *PaymentRequestRepository) AddEvent(ctx context.Context, id int, status string, actorID int, note string) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "payrequest.AddEvent")
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO payment_request_events (request_id, status, actor_id, note, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, id, status, actorID, note, time.Now())
+	return err
+}
+
+// ExpireOverdue помечает просроченные запросы
+func (r *PaymentRequestRepository) ExpireOverdue(ctx context.Context) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "payrequest.ExpireOverdue")
+	defer cancel()
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, `
+		WITH expired AS (
+			UPDATE payment_requests SET status = $1, updated_at = $2
+			WHERE status = $3 AND expires_at <= $2
+			RETURNING id
+		)
+		INSERT INTO payment_request_events (request_id, status, created_at)
+		SELECT id, $1, $2 FROM expired
+	`, StatusExpired, now, StatusPending)
+	return err
+}
+
+const columns = `p.id, p.requester_id, rq.name, p.payer_id, pr.name, p.amount, p.currency, p.note,
+	p.status, p.expires_at, p.created_at`
+
+const joins = `payment_requests p
+	JOIN users rq ON rq.id = p.requester_id
+	JOIN users pr ON pr.id = p.payer_id`
+
+func (r *PaymentRequestRepository) scanAll(ctx context.Context, rows *sql.Rows) ([]*PaymentRequest, error) {
+	var list []*PaymentRequest
+	for rows.Next() {
+		p := &PaymentRequest{}
+		err := rows.Scan(&p.ID, &p.RequesterID, &p.RequesterName, &p.PayerID, &p.PayerName, &p.Amount, &p.Currency, &p.Note,
+			&p.Status, &p.ExpiresAt, &p.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		err = r.pii.DecryptAll(ctx,
+			pii.Field{Column: pii.UserName, RowID: p.RequesterID, Value: &p.RequesterName},
+			pii.Field{Column: pii.UserName, RowID: p.PayerID, Value: &p.PayerName})
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+func insertEvent(ctx context.Context, tx *sql.Tx, id int, status string, actorID int, note string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO payment_request_events (request_id, status, actor_id, note, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, id, status, actorID, note, time.Now())
+	return err
+}
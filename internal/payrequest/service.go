@@ -0,0 +1,132 @@
+package payrequest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"online_bank/internal/currency"
+	"online_bank/internal/user"
+)
+
+const maxExpiry = 30 * 24 * time.Hour
+
+// Transferer выполняет перевод; реализуется user.UserService
+type Transferer interface {
+	TransferWith(ctx context.Context, fromID, toID int, amount float64, cur string, opts user.TransferOptions) error
+}
+
+type PaymentRequestService struct {
+	repo      *PaymentRequestRepository
+	transfers Transferer
+}
+
+func NewPaymentRequestService(repo *PaymentRequestRepository, transfers Transferer) *PaymentRequestService {
+	return &PaymentRequestService{repo: repo, transfers: transfers}
+}
+
+func (s *PaymentRequestService) Create(ctx context.Context, requesterID, payerID int, amount float64, cur, note string, expiresIn time.Duration) error {
+	if amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if !currency.IsSupported(cur) {
+		return errors.New("unsupported currency")
+	}
+	if requesterID == payerID {
+		return errors.New("cannot request money from yourself")
+	}
+	if expiresIn <= 0 || expiresIn > maxExpiry {
+		return errors.New("expiry must be between 1 and 30 days")
+	}
+
+	return s.repo.Create(ctx, &PaymentRequest{
+		RequesterID: requesterID,
+		PayerID:     payerID,
+		Amount:      amount,
+		Currency:    cur,
+		Note:        note,
+		ExpiresAt:   time.Now().Add(expiresIn),
+	})
+}
+
+// List возвращает входящие и исходящие запросы пользователя вместе с историей
+func (s *PaymentRequestService) List(ctx context.Context, userID int) ([]*PaymentRequest, error) {
+	if err := s.repo.ExpireOverdue(ctx); err != nil {
+		return nil, err
+	}
+
+	list, err := s.repo.ListForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, len(list))
+	for i, p := range list {
+		ids[i] = p.ID
+	}
+	history, err := s.repo.History(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		p.History = history[p.ID]
+	}
+	return list, nil
+}
+
+func (s *PaymentRequestService) Pending(ctx context.Context, payerID int) ([]*PaymentRequest, error) {
+	return s.repo.PendingForPayer(ctx, payerID)
+}
+
+// Approve оплачивает запрос. Статус меняется в транзакции перевода: параллельное нажатие
+// не пройдёт проверку статуса и откатит свой перевод, а запрос не зависнет между шагами.
+func (s *PaymentRequestService) Approve(ctx context.Context, id, payerID int) error {
+	p, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if p.PayerID != payerID || p.Status != StatusPending {
+		return errNotPending
+	}
+	if !p.ExpiresAt.After(time.Now()) {
+		s.repo.ExpireOverdue(ctx)
+		return errors.New("payment request has expired")
+	}
+
+	err = s.transfers.TransferWith(ctx, payerID, p.RequesterID, p.Amount, p.Currency, user.TransferOptions{
+		InTx: func(ctx context.Context, tx *sql.Tx) error {
+			return s.repo.Approve(ctx, tx, id, payerID)
+		},
+	})
+	if err != nil && !errors.Is(err, errNotPending) {
+		// Неудачная попытка остаётся в истории, даже если клиент уже отключился
+		if err := s.repo.AddEvent(context.WithoutCancel(ctx), id, StatusFailed, payerID, err.Error()); err != nil {
+			slog.ErrorContext(ctx, "не удалось записать неудачную оплату запроса", "request_id", id, "err", err)
+		}
+	}
+	return err
+}
+
+func (s *PaymentRequestService) Decline(ctx context.Context, id, payerID int, reason string) error {
+	ok, err := s.repo.ChangeStatus(ctx, id, StatusPending, StatusDeclined, payerID, "payer_id", reason)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errNotPending
+	}
+	return nil
+}
+
+func (s *PaymentRequestService) Cancel(ctx context.Context, id, requesterID int) error {
+	ok, err := s.repo.ChangeStatus(ctx, id, StatusPending, StatusCancelled, requesterID, "requester_id", "")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errNotPending
+	}
+	return nil
+}
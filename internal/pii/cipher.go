@@ -0,0 +1,225 @@
+package pii
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// prefix отличает зашифрованное значение от открытого текста, записанного до шифрования
+	prefix = "pii:v2:"
+	// legacyPrefix — значения без привязки к ячейке; сервер перешифровывает их при старте
+	legacyPrefix = "pii:v1:"
+)
+
+// Зашифрованные столбцы
+const (
+	UserName        = "users.name"
+	UserEmail       = "users.email"
+	ProfileFullName = "profiles.full_name"
+	ProfileBio      = "profiles.bio"
+)
+
+// Field — зашифрованное значение из столбца Column строки RowID
+type Field struct {
+	Column string
+	RowID  int
+	Value  *string
+}
+
+var errMalformed = errors.New("malformed encrypted value")
+
+// Cipher шифрует поля с персональными данными конвертом: значение — AES-256-GCM
+// ключом данных (DEK), а DEK хранится рядом, зашифрованный ключом шифрования
+// ключей (KEK) у KeyProvider. Значение в базе:
+//
+//	pii:v2:<id KEK>:<DEK, зашифрованный KEK>:<nonce и шифртекст>
+//
+// Шифртекст привязан к ячейке: столбец и id строки передаются в GCM как связанные
+// данные, поэтому значение, скопированное в другую строку или столбец, не расшифруется.
+//
+// Процесс создаёт один DEK на запуск, поэтому KeyProvider вызывается при старте
+// и по разу на каждый ранее не встречавшийся DEK при чтении.
+type Cipher struct {
+	keys     KeyProvider
+	indexKey []byte
+
+	keyID   string
+	wrapped string
+	aead    cipher.AEAD
+
+	mu    sync.Mutex
+	cache map[string]cipher.AEAD
+}
+
+// New создаёт DEK процесса и оборачивает его текущим KEK. indexKey — секрет
+// для слепых индексов; его нельзя менять, не пересчитав индексы.
+func New(ctx context.Context, keys KeyProvider, indexKey string) (*Cipher, error) {
+	if indexKey == "" {
+		return nil, errors.New("pii index key is required")
+	}
+	keyID := keys.CurrentKeyID()
+	if keyID == "" || strings.Contains(keyID, ":") {
+		return nil, fmt.Errorf("invalid key id %q", keyID)
+	}
+
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	wrapped, err := keys.WrapKey(ctx, keyID, dek)
+	if err != nil {
+		return nil, fmt.Errorf("wrap data key: %w", err)
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cipher{
+		keys:     keys,
+		indexKey: []byte(indexKey),
+		keyID:    keyID,
+		wrapped:  base64.RawStdEncoding.EncodeToString(wrapped),
+		aead:     aead,
+		cache:    map[string]cipher.AEAD{},
+	}
+	c.cache[keyID+":"+c.wrapped] = aead
+	return c, nil
+}
+
+// KeyID — KEK, которым шифруются новые значения
+func (c *Cipher) KeyID() string {
+	return c.keyID
+}
+
+// Encrypt шифрует значение для столбца column строки rowID текущим DEK
+func (c *Cipher) Encrypt(plaintext, column string, rowID int) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), cell(column, rowID))
+	return prefix + c.keyID + ":" + c.wrapped + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt расшифровывает значение из столбца column строки rowID. Открытый текст,
+// ещё не зашифрованный после включения шифрования, возвращается как есть.
+func (c *Cipher) Decrypt(ctx context.Context, value, column string, rowID int) (string, error) {
+	ad := cell(column, rowID)
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		if rest, ok = strings.CutPrefix(value, legacyPrefix); !ok {
+			return value, nil
+		}
+		ad = nil
+	}
+	parts := strings.Split(rest, ":")
+	if len(parts) != 3 {
+		return "", errMalformed
+	}
+	keyID, wrapped, body := parts[0], parts[1], parts[2]
+
+	aead, err := c.dataKey(ctx, keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(body)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errMalformed
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], ad)
+	if err != nil {
+		return "", fmt.Errorf("decrypt pii: %w", err)
+	}
+	return string(plain), nil
+}
+
+// DecryptAll расшифровывает значения на месте — для строк с несколькими полями
+func (c *Cipher) DecryptAll(ctx context.Context, fields ...Field) error {
+	for _, f := range fields {
+		plain, err := c.Decrypt(ctx, *f.Value, f.Column, f.RowID)
+		if err != nil {
+			return err
+		}
+		*f.Value = plain
+	}
+	return nil
+}
+
+// BlindIndex — детерминированный HMAC значения для поиска на равенство
+// по зашифрованному полю. Регистр и пробелы по краям не учитываются.
+func (c *Cipher) BlindIndex(value string) string {
+	m := hmac.New(sha256.New, c.indexKey)
+	m.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// NameIndex — слепой индекс имени: как BlindIndex, но пробелы внутри имени схлопываются,
+// чтобы «Иван  Петров» нашёлся по «иван петров»
+func (c *Cipher) NameIndex(name string) string {
+	return c.BlindIndex(strings.Join(strings.Fields(name), " "))
+}
+
+// CurrentPattern — шаблон LIKE для значений, зашифрованных текущим KEK;
+// строки, которые ему не соответствуют, нужно перешифровать
+func (c *Cipher) CurrentPattern() string {
+	return prefix + c.keyID + ":%"
+}
+
+// EncryptedPattern — шаблон LIKE для любых зашифрованных значений
+func EncryptedPattern() string {
+	return prefix + "%"
+}
+
+func (c *Cipher) dataKey(ctx context.Context, keyID, wrapped string) (cipher.AEAD, error) {
+	cacheKey := keyID + ":" + wrapped
+	c.mu.Lock()
+	aead, ok := c.cache[cacheKey]
+	c.mu.Unlock()
+	if ok {
+		return aead, nil
+	}
+
+	raw, err := base64.RawStdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, errMalformed
+	}
+	dek, err := c.keys.UnwrapKey(ctx, keyID, raw)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	aead, err = newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.cache[cacheKey] = aead
+	c.mu.Unlock()
+	return aead, nil
+}
+
+// cell — связанные данные GCM: ячейка, к которой привязан шифртекст
+func cell(column string, rowID int) []byte {
+	return []byte(column + ":" + strconv.Itoa(rowID))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,176 @@
+package pii
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeKeys — KeyProvider в памяти: «оборачивает» DEK, дописывая к нему id ключа
+type fakeKeys struct {
+	current string
+	unwraps int
+}
+
+func (k *fakeKeys) CurrentKeyID() string { return k.current }
+
+func (k *fakeKeys) WrapKey(ctx context.Context, keyID string, dek []byte) ([]byte, error) {
+	return append([]byte(keyID+"/"), dek...), nil
+}
+
+func (k *fakeKeys) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	k.unwraps++
+	dek, ok := strings.CutPrefix(string(wrapped), keyID+"/")
+	if !ok {
+		return nil, errors.New("wrapped with another key")
+	}
+	return []byte(dek), nil
+}
+
+func newTestCipher(t *testing.T, keys *fakeKeys) *Cipher {
+	t.Helper()
+	c, err := New(context.Background(), keys, "index-secret")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return c
+}
+
+func TestCipherRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCipher(t, &fakeKeys{current: "k1"})
+
+	for _, plain := range []string{"Иван Петров", "ivan@example.com", ""} {
+		enc, err := c.Encrypt(plain, UserName, 7)
+		if err != nil {
+			t.Fatalf("Encrypt(%q): %v", plain, err)
+		}
+		if !strings.HasPrefix(enc, prefix+"k1:") {
+			t.Fatalf("значение %q без префикса текущего ключа", enc)
+		}
+		if plain != "" && strings.Contains(enc, plain) {
+			t.Fatalf("открытый текст виден в %q", enc)
+		}
+		got, err := c.Decrypt(ctx, enc, UserName, 7)
+		if err != nil {
+			t.Fatalf("Decrypt: %v", err)
+		}
+		if got != plain {
+			t.Fatalf("Decrypt = %q, ожидалось %q", got, plain)
+		}
+	}
+}
+
+func TestCipherDecryptOtherProcess(t *testing.T) {
+	ctx := context.Background()
+	old := newTestCipher(t, &fakeKeys{current: "k1"})
+	enc, err := old.Encrypt("Иван Петров", UserName, 7)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	// После смены ключа новый процесс разворачивает DEK старого один раз и дальше берёт из кеша
+	keys := &fakeKeys{current: "k2"}
+	c := newTestCipher(t, keys)
+	for i := 0; i < 2; i++ {
+		got, err := c.Decrypt(ctx, enc, UserName, 7)
+		if err != nil {
+			t.Fatalf("Decrypt: %v", err)
+		}
+		if got != "Иван Петров" {
+			t.Fatalf("Decrypt = %q", got)
+		}
+	}
+	if keys.unwraps != 1 {
+		t.Fatalf("UnwrapKey вызван %d раз, ожидался 1", keys.unwraps)
+	}
+}
+
+func TestCipherRejectsMovedValue(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCipher(t, &fakeKeys{current: "k1"})
+	enc, err := c.Encrypt("ivan@example.com", UserEmail, 7)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		column string
+		rowID  int
+	}{
+		{name: "другая строка", column: UserEmail, rowID: 8},
+		{name: "другой столбец", column: UserName, rowID: 7},
+		{name: "другая таблица", column: ProfileFullName, rowID: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := c.Decrypt(ctx, enc, tt.column, tt.rowID); err == nil {
+				t.Fatalf("значение расшифровалось в чужой ячейке: %q", got)
+			}
+		})
+	}
+}
+
+func TestCipherLegacyValue(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCipher(t, &fakeKeys{current: "k1"})
+
+	// Значение v1 зашифровано без привязки к ячейке
+	nonce := make([]byte, c.aead.NonceSize())
+	sealed := c.aead.Seal(nonce, nonce, []byte("Иван Петров"), nil)
+	legacy := legacyPrefix + c.keyID + ":" + c.wrapped + ":" + base64.RawStdEncoding.EncodeToString(sealed)
+
+	for _, rowID := range []int{7, 8} {
+		got, err := c.Decrypt(ctx, legacy, UserName, rowID)
+		if err != nil {
+			t.Fatalf("Decrypt v1: %v", err)
+		}
+		if got != "Иван Петров" {
+			t.Fatalf("Decrypt v1 = %q", got)
+		}
+	}
+
+	// Открытый текст, записанный до включения шифрования, возвращается как есть
+	if got, err := c.Decrypt(ctx, "Иван Петров", UserName, 7); err != nil || got != "Иван Петров" {
+		t.Fatalf("Decrypt открытого текста = %q, %v", got, err)
+	}
+	if _, err := c.Decrypt(ctx, prefix+"k1:broken", UserName, 7); !errors.Is(err, errMalformed) {
+		t.Fatalf("повреждённое значение: ошибка %v, ожидалась %v", err, errMalformed)
+	}
+}
+
+func TestCipherIndexes(t *testing.T) {
+	c := newTestCipher(t, &fakeKeys{current: "k1"})
+
+	tests := []struct {
+		name  string
+		index func(string) string
+		a, b  string
+		equal bool
+	}{
+		{name: "email без учёта регистра", index: c.BlindIndex, a: "Ivan@Example.com", b: "ivan@example.com", equal: true},
+		{name: "email без пробелов по краям", index: c.BlindIndex, a: "  ivan@example.com\t", b: "ivan@example.com", equal: true},
+		{name: "разные email", index: c.BlindIndex, a: "ivan@example.com", b: "petr@example.com"},
+		{name: "пробелы внутри значения важны для BlindIndex", index: c.BlindIndex, a: "Иван  Петров", b: "Иван Петров"},
+		{name: "имя со схлопнутыми пробелами", index: c.NameIndex, a: " Иван \t Петров ", b: "иван петров", equal: true},
+		{name: "разные имена", index: c.NameIndex, a: "Иван Петров", b: "Пётр Иванов"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.index(tt.a) == tt.index(tt.b); got != tt.equal {
+				t.Fatalf("индексы %q и %q совпадают: %v, ожидалось %v", tt.a, tt.b, got, tt.equal)
+			}
+		})
+	}
+
+	other, err := New(context.Background(), &fakeKeys{current: "k1"}, "other-secret")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if c.BlindIndex("ivan@example.com") == other.BlindIndex("ivan@example.com") {
+		t.Fatal("индекс не зависит от секрета")
+	}
+}
@@ -0,0 +1,148 @@
+package pii
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// KeyProvider хранит ключи шифрования ключей (KEK) и шифрует ими ключи данных.
+// Интерфейс повторяет Encrypt/Decrypt облачных KMS: сам KEK наружу не отдаётся.
+type KeyProvider interface {
+	// CurrentKeyID — KEK для новых ключей данных
+	CurrentKeyID() string
+	WrapKey(ctx context.Context, keyID string, dek []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Провайдеры для Config.Provider
+const (
+	ProviderKeyfile = "keyfile"
+	ProviderKMS     = "kms"
+)
+
+// Config — шифрование персональных данных из config.json:
+//
+//	"pii": {"provider": "keyfile", "keyfile": "pii-keys.json", "index_key": "СЕКРЕТ"}
+type Config struct {
+	// Provider — "keyfile" (по умолчанию) или "kms"
+	Provider string    `json:"provider"`
+	Keyfile  string    `json:"keyfile"`
+	KMS      KMSConfig `json:"kms"`
+	// IndexKey — секрет слепых индексов (поиск по email и имени)
+	IndexKey string `json:"index_key"`
+}
+
+// DefaultKeyfile — файл ключей, если в конфиге не задан другой
+const DefaultKeyfile = "pii-keys.json"
+
+// NewProvider возвращает провайдер ключей по конфигу
+func NewProvider(cfg Config) (KeyProvider, error) {
+	switch cfg.Provider {
+	case "", ProviderKeyfile:
+		return LoadKeyfile(cfg.KeyfilePath())
+	case ProviderKMS:
+		return NewKMSClient(cfg.KMS)
+	default:
+		return nil, fmt.Errorf("unknown pii key provider %q", cfg.Provider)
+	}
+}
+
+// KeyfilePath — путь к файлу ключей
+func (c Config) KeyfilePath() string {
+	if c.Keyfile == "" {
+		return DefaultKeyfile
+	}
+	return c.Keyfile
+}
+
+// Keyfile — KEK в локальном JSON-файле:
+//
+//	{"current": "2026-10", "keys": {"2026-10": "<32 байта в base64>", "2026-01": "..."}}
+//
+// Старые ключи остаются в файле, пока данные не перешифрованы новым.
+type Keyfile struct {
+	Current string            `json:"current"`
+	Keys    map[string][]byte `json:"keys"`
+}
+
+func LoadKeyfile(path string) (*Keyfile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyfile{}
+	if err := json.Unmarshal(b, k); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, ok := k.Keys[k.Current]; !ok {
+		return nil, fmt.Errorf("%s: current key %q not found", path, k.Current)
+	}
+	return k, nil
+}
+
+// AddKey создаёт новый KEK и делает его текущим
+func (k *Keyfile) AddKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	id := time.Now().UTC().Format("20060102-150405")
+	if k.Keys == nil {
+		k.Keys = map[string][]byte{}
+	}
+	k.Keys[id] = key
+	k.Current = id
+	return id, nil
+}
+
+// Save записывает файл с правами только для владельца
+func (k *Keyfile) Save(path string) error {
+	b, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+func (k *Keyfile) CurrentKeyID() string {
+	return k.Current
+}
+
+func (k *Keyfile) WrapKey(_ context.Context, keyID string, dek []byte) ([]byte, error) {
+	aead, err := k.kek(keyID)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dek, []byte(keyID)), nil
+}
+
+func (k *Keyfile) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, err := k.kek(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errMalformed
+	}
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+}
+
+func (k *Keyfile) kek(keyID string) (cipher.AEAD, error) {
+	key, ok := k.Keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", keyID)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key %q must be 32 bytes", keyID)
+	}
+	return newAEAD(key)
+}
@@ -0,0 +1,125 @@
+package pii
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// KMSConfig — внешний сервис ключей с API wrap/unwrap:
+//
+//	"kms": {"url": "http://localhost:9443", "key_id": "2026-10", "token": "СЕКРЕТ"}
+//
+// Для разработки есть cmd/kms-standin; для облачного KMS достаточно своей
+// реализации KeyProvider поверх его SDK.
+type KMSConfig struct {
+	URL   string `json:"url"`
+	KeyID string `json:"key_id"`
+	Token string `json:"token"`
+}
+
+// KMSClient — KeyProvider, который шифрует ключи данных во внешнем сервисе
+type KMSClient struct {
+	cfg    KMSConfig
+	client *http.Client
+}
+
+func NewKMSClient(cfg KMSConfig) (*KMSClient, error) {
+	if cfg.URL == "" || cfg.KeyID == "" {
+		return nil, errors.New("pii.kms.url and pii.kms.key_id are required")
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	return &KMSClient{cfg: cfg, client: &http.Client{Timeout: 5 * time.Second}}, nil
+}
+
+// kmsRequest и kmsResponse — тела запросов /v1/wrap и /v1/unwrap
+type kmsRequest struct {
+	KeyID string `json:"key_id"`
+	Data  []byte `json:"data"`
+}
+
+type kmsResponse struct {
+	Data  []byte `json:"data"`
+	Error string `json:"error,omitempty"`
+}
+
+func (c *KMSClient) CurrentKeyID() string {
+	return c.cfg.KeyID
+}
+
+func (c *KMSClient) WrapKey(ctx context.Context, keyID string, dek []byte) ([]byte, error) {
+	return c.call(ctx, "/v1/wrap", keyID, dek)
+}
+
+func (c *KMSClient) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	return c.call(ctx, "/v1/unwrap", keyID, wrapped)
+}
+
+func (c *KMSClient) call(ctx context.Context, path, keyID string, data []byte) ([]byte, error) {
+	body, err := json.Marshal(kmsRequest{KeyID: keyID, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out kmsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("kms %s: status %d", path, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kms %s: %s", path, out.Error)
+	}
+	return out.Data, nil
+}
+
+// KMSHandler — сервер того же API поверх файла ключей; KEK не покидают его процесс
+func KMSHandler(keys *Keyfile, token string) http.Handler {
+	mux := http.NewServeMux()
+	serve := func(op func(ctx context.Context, keyID string, data []byte) ([]byte, error)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			bearer, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(kmsResponse{Error: "unauthorized"})
+				return
+			}
+
+			var req kmsRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(kmsResponse{Error: err.Error()})
+				return
+			}
+			data, err := op(r.Context(), req.KeyID, req.Data)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(kmsResponse{Error: err.Error()})
+				return
+			}
+			json.NewEncoder(w).Encode(kmsResponse{Data: data})
+		}
+	}
+	mux.HandleFunc("POST /v1/wrap", serve(keys.WrapKey))
+	mux.HandleFunc("POST /v1/unwrap", serve(keys.UnwrapKey))
+	return mux
+}
@@ -0,0 +1,158 @@
+package qrpay
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"online_bank/internal/audit"
+	"online_bank/internal/currency"
+	"online_bank/internal/user"
+
+	"github.com/skip2/go-qrcode"
+)
+
+type QRHandler struct {
+	signer    *Signer
+	publicURL string
+	users     *user.UserService
+	audit     *audit.AuditService
+	templates *template.Template
+}
+
+// NewQRHandler: publicURL — адрес сайта, на который ведут ссылки в кодах
+func NewQRHandler(signer *Signer, publicURL string, users *user.UserService, audit *audit.AuditService, templates *template.Template) *QRHandler {
+	return &QRHandler{signer: signer, publicURL: strings.TrimSuffix(publicURL, "/"), users: users, audit: audit, templates: templates}
+}
+
+// GeneratePage показывает форму и, если она отправлена, QR-код со ссылкой на /pay
+func (h *QRHandler) GeneratePage(w http.ResponseWriter, r *http.Request) {
+	u := user.CurrentUser(r.Context())
+	data := map[string]interface{}{"User": u}
+
+	if r.Method == http.MethodPost {
+		p := Payload{
+			RecipientID: u.ID,
+			Currency:    r.FormValue("currency"),
+			Reference:   r.FormValue("reference"),
+		}
+		if !currency.IsSupported(p.Currency) {
+			http.Error(w, "unsupported currency", http.StatusBadRequest)
+			return
+		}
+		if v := r.FormValue("amount"); v != "" {
+			amount, err := strconv.ParseFloat(v, 64)
+			if err != nil || amount < 0 {
+				http.Error(w, "invalid amount", http.StatusBadRequest)
+				return
+			}
+			p.Amount = amount
+		}
+
+		token, err := h.signer.Encode(p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data["Payload"] = p
+		data["Token"] = token
+		data["Link"] = h.payLink(token)
+	}
+
+	h.templates.ExecuteTemplate(w, "qr.html", data)
+}
+
+// ImagePage отдаёт PNG с QR-кодом ссылки на оплату
+func (h *QRHandler) ImagePage(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("p")
+	if _, err := h.signer.Decode(token); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	png, err := qrcode.Encode(h.payLink(token), qrcode.Medium, 256)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
+
+// PayPage — оплата по коду: ввод суммы (если её нет в коде), подтверждение с комиссией
+// и сам перевод (confirm=1). Каждый шаг получает подписанный код p и заново проверяет
+// подпись, поэтому получатель, валюта, назначение и зашитая в код сумма берутся только
+// из кода, а не из полей формы.
+func (h *QRHandler) PayPage(w http.ResponseWriter, r *http.Request) {
+	payerID := user.CurrentUser(r.Context()).ID
+
+	token := r.FormValue("p")
+	p, err := h.signer.Decode(token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	amount := p.Amount
+	// Сумма не зашита в код — плательщик вводит её сам
+	if amount == 0 {
+		if r.Method != http.MethodPost {
+			recipient, err := h.users.GetBalance(r.Context(), p.RecipientID)
+			if err != nil {
+				http.Error(w, "recipient not found", http.StatusBadRequest)
+				return
+			}
+			h.templates.ExecuteTemplate(w, "pay.html", map[string]interface{}{
+				"Payload":       p,
+				"Token":         token,
+				"RecipientName": recipient.Name,
+			})
+			return
+		}
+		amount, err = strconv.ParseFloat(r.FormValue("amount"), 64)
+		if err != nil {
+			http.Error(w, "invalid amount", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if r.Method == http.MethodPost && r.FormValue("confirm") == "1" {
+		err := h.users.TransferWith(r.Context(), payerID, p.RecipientID, amount, p.Currency,
+			user.TransferOptions{PaymentReference: p.Reference})
+		h.record(r, p, amount, err)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	quote, err := h.users.QuoteTransfer(r.Context(), payerID, p.RecipientID, amount, p.Currency)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	quote.Reference = p.Reference
+	quote.PaymentCode = token
+	h.templates.ExecuteTemplate(w, "transfer_confirm.html", quote)
+}
+
+// record пишет оплату по коду в журнал аудита вместе с назначением платежа
+func (h *QRHandler) record(r *http.Request, p *Payload, amount float64, opErr error) {
+	after := map[string]interface{}{"amount": amount, "currency": p.Currency, "payment_reference": p.Reference}
+	err := h.audit.Record(r.Context(), audit.ActorFromRequest(r, user.CurrentUser(r.Context()).ID), "money.qr_payment", "user", p.RecipientID, nil, after, opErr)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "не удалось записать в журнал аудита", "action", "money.qr_payment", "err", err)
+	}
+}
+
+// payLink строится от настроенного адреса, а не от заголовка Host: /qr/image открыт
+// без входа, и подставленный Host попал бы в код и в кеш прокси
+func (h *QRHandler) payLink(token string) string {
+	return h.publicURL + "/pay?p=" + url.QueryEscape(token)
+}
@@ -0,0 +1,65 @@
+package qrpay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Payload — данные платёжного QR-кода. Amount == 0 означает, что сумму вводит плательщик.
+type Payload struct {
+	RecipientID int     `json:"r"`
+	Amount      float64 `json:"a,omitempty"`
+	Currency    string  `json:"c"`
+	Reference   string  `json:"ref,omitempty"`
+}
+
+// Signer упаковывает Payload в строку вида base64(json).base64(hmac),
+// чтобы сумму и получателя нельзя было подменить
+type Signer struct {
+	secret []byte
+}
+
+func NewSigner(secret []byte) *Signer {
+	return &Signer{secret: secret}
+}
+
+func (s *Signer) Encode(p Payload) (string, error) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	data := base64.RawURLEncoding.EncodeToString(body)
+	return data + "." + base64.RawURLEncoding.EncodeToString(s.sign(data)), nil
+}
+
+func (s *Signer) Decode(token string) (*Payload, error) {
+	data, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errors.New("malformed payment code")
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.sign(data)) {
+		return nil, errors.New("invalid payment code signature")
+	}
+
+	body, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return nil, errors.New("malformed payment code")
+	}
+	p := &Payload{}
+	if err := json.Unmarshal(body, p); err != nil {
+		return nil, errors.New("malformed payment code")
+	}
+	return p, nil
+}
+
+func (s *Signer) sign(data string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval — как часто удалять корзины, которые успели наполниться целиком
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full — когда корзина наполнится, если запросов больше не будет
+	full time.Time
+}
+
+// MemoryBackend держит корзины в памяти процесса. Подходит для одного экземпляра;
+// за балансировщиком с несколькими экземплярами нужен Redis.
+type MemoryBackend struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	// now — часы; в тестах подменяются
+	now func() time.Time
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (m *MemoryBackend) Allow(_ context.Context, key string, rule Rule) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) > sweepInterval {
+		m.sweep(now)
+	}
+
+	capacity, rate := rule.capacity(), rule.perSecond()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, seconds((1 - b.tokens) / rate), nil
+	}
+	b.tokens--
+	b.full = now.Add(seconds((capacity - b.tokens) / rate))
+	return true, 0, nil
+}
+
+// sweep убирает наполненные корзины: новая корзина для того же ключа будет такой же
+func (m *MemoryBackend) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if now.After(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
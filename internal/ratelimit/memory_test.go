@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"online_bank/internal/timeouts"
+)
+
+func TestMemoryBackendAllow(t *testing.T) {
+	type step struct {
+		// after — сколько прошло с предыдущего запроса
+		after     time.Duration
+		allowed   bool
+		retryWait time.Duration
+	}
+	tests := []struct {
+		name  string
+		rule  Rule
+		steps []step
+	}{
+		{
+			name: "ёмкость равна Requests, пока Burst не задан",
+			rule: Rule{Requests: 2, Per: timeouts.Duration(time.Second)},
+			steps: []step{
+				{allowed: true},
+				{allowed: true},
+				{allowed: false, retryWait: 500 * time.Millisecond},
+			},
+		},
+		{
+			name: "Burst пропускает серию сверх Requests",
+			rule: Rule{Requests: 1, Per: timeouts.Duration(time.Minute), Burst: 3},
+			steps: []step{
+				{allowed: true},
+				{allowed: true},
+				{allowed: true},
+				{allowed: false, retryWait: time.Minute},
+			},
+		},
+		{
+			name: "корзина наполняется со временем",
+			rule: Rule{Requests: 1, Per: timeouts.Duration(10 * time.Second)},
+			steps: []step{
+				{allowed: true},
+				{after: 4 * time.Second, allowed: false, retryWait: 6 * time.Second},
+				{after: 6 * time.Second, allowed: true},
+				{allowed: false, retryWait: 10 * time.Second},
+			},
+		},
+		{
+			name: "после долгой паузы токенов не больше ёмкости",
+			rule: Rule{Requests: 1, Per: timeouts.Duration(time.Second), Burst: 2},
+			steps: []step{
+				{allowed: true},
+				{allowed: true},
+				{after: time.Hour, allowed: true},
+				{allowed: true},
+				{allowed: false, retryWait: time.Second},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			m := NewMemoryBackend()
+			m.now = func() time.Time { return now }
+
+			for i, s := range tt.steps {
+				now = now.Add(s.after)
+				allowed, wait, err := m.Allow(context.Background(), "key", tt.rule)
+				if err != nil {
+					t.Fatalf("шаг %d: %v", i, err)
+				}
+				if allowed != s.allowed {
+					t.Fatalf("шаг %d: allowed = %v, want %v", i, allowed, s.allowed)
+				}
+				if diff := wait - s.retryWait; diff < -time.Millisecond || diff > time.Millisecond {
+					t.Fatalf("шаг %d: retry after = %v, want %v", i, wait, s.retryWait)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryBackendKeysAreIndependent(t *testing.T) {
+	m := NewMemoryBackend()
+	rule := Rule{Requests: 1, Per: timeouts.Duration(time.Minute)}
+
+	if ok, _, _ := m.Allow(context.Background(), "a", rule); !ok {
+		t.Fatal("первый запрос для a отклонён")
+	}
+	if ok, _, _ := m.Allow(context.Background(), "b", rule); !ok {
+		t.Fatal("запрос для b отклонён из-за корзины a")
+	}
+	if ok, _, _ := m.Allow(context.Background(), "a", rule); ok {
+		t.Fatal("второй запрос для a пропущен")
+	}
+}
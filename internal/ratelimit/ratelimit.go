@@ -0,0 +1,220 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"online_bank/internal/metrics"
+	"online_bank/internal/timeouts"
+)
+
+// Rule — корзина токенов: Requests запросов за Per, но не больше Burst подряд
+type Rule struct {
+	Requests int               `json:"requests"`
+	Per      timeouts.Duration `json:"per"`
+	// Burst — ёмкость корзины; 0 — столько же, сколько Requests
+	Burst int `json:"burst"`
+}
+
+// Enabled — задано ли ограничение
+func (r Rule) Enabled() bool {
+	return r.Requests > 0 && r.Per > 0
+}
+
+func (r Rule) capacity() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return float64(r.Requests)
+}
+
+// perSecond — сколько токенов добавляется в корзину за секунду
+func (r Rule) perSecond() float64 {
+	return float64(r.Requests) / time.Duration(r.Per).Seconds()
+}
+
+// Policy — ограничения маршрута: по IP-адресу клиента и по вошедшему пользователю
+type Policy struct {
+	IP   Rule `json:"ip"`
+	User Rule `json:"user"`
+}
+
+// Бэкенды для Config.Backend
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+	BackendNone   = "none"
+)
+
+// Config — ограничение частоты запросов из config.json:
+//
+//	"rate_limit": {"backend": "redis", "redis": {"addr": "localhost:6379"},
+//	  "routes": {"/login": {"ip": {"requests": 5, "per": "1m", "burst": 10}}}}
+//
+// Ключ маршрута — шаблон из main.go: "/login", "/api/v1/transfers".
+type Config struct {
+	// Backend — "memory" (по умолчанию), "redis" или "none"
+	Backend string      `json:"backend"`
+	Redis   RedisConfig `json:"redis"`
+	// TrustProxy — брать адрес клиента из X-Forwarded-For, который добавил балансировщик
+	TrustProxy bool `json:"trust_proxy"`
+	// Default — для маршрутов без своей политики
+	Default Policy            `json:"default"`
+	Routes  map[string]Policy `json:"routes"`
+}
+
+// builtin — маршруты, которые ограничены, даже если в config.json о них ничего нет.
+// Считаются запросы любым методом: открытие формы тоже тратит токен.
+var builtin = map[string]Policy{
+	"/login":    {IP: Rule{Requests: 20, Per: timeouts.Duration(time.Minute), Burst: 10}},
+	"/register": {IP: Rule{Requests: 20, Per: timeouts.Duration(time.Hour), Burst: 10}},
+	"/transfer": {
+		IP:   Rule{Requests: 60, Per: timeouts.Duration(time.Minute)},
+		User: Rule{Requests: 20, Per: timeouts.Duration(time.Minute), Burst: 5},
+	},
+	"/api/oauth/token":  {IP: Rule{Requests: 10, Per: timeouts.Duration(time.Minute)}},
+	"/api/v1/transfers": {User: Rule{Requests: 20, Per: timeouts.Duration(time.Minute), Burst: 5}},
+}
+
+// For возвращает политику маршрута route
+func (c Config) For(route string) Policy {
+	if p, ok := c.Routes[route]; ok {
+		return p
+	}
+	if p, ok := builtin[route]; ok {
+		return p
+	}
+	return c.Default
+}
+
+// Backend хранит корзины. Allow забирает токен из корзины key и, если его нет,
+// говорит, через сколько он появится.
+type Backend interface {
+	Allow(ctx context.Context, key string, rule Rule) (ok bool, retryAfter time.Duration, err error)
+}
+
+// Identify возвращает идентификатор вошедшего пользователя или "", если вход не выполнен
+type Identify func(r *http.Request) string
+
+// Limiter отклоняет с 429 запросы сверх политики маршрута
+type Limiter struct {
+	cfg      Config
+	backend  Backend
+	mux      *http.ServeMux
+	identify Identify
+}
+
+// New собирает ограничитель для маршрутов mux. identify вызывается, только если
+// у маршрута есть ограничение по пользователю.
+func New(cfg Config, mux *http.ServeMux, identify Identify) (*Limiter, error) {
+	l := &Limiter{cfg: cfg, mux: mux, identify: identify}
+	switch cfg.Backend {
+	case "", BackendMemory:
+		l.backend = NewMemoryBackend()
+	case BackendRedis:
+		b, err := NewRedisBackend(cfg.Redis)
+		if err != nil {
+			return nil, err
+		}
+		l.backend = b
+	case BackendNone:
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", cfg.Backend)
+	}
+	return l, nil
+}
+
+// Close освобождает соединения бэкенда
+func (l *Limiter) Close() error {
+	if c, ok := l.backend.(interface{ Close() error }); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Middleware проверяет запрос до обработчика: сначала по IP, затем по пользователю.
+// Если бэкенд недоступен, запрос пропускается — лучше без ограничения, чем без сервиса.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	if l.backend == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := l.mux.Handler(r)
+		policy := l.cfg.For(route)
+
+		if policy.IP.Enabled() {
+			if !l.allow(w, r, route, "ip", l.clientIP(r), policy.IP) {
+				return
+			}
+		}
+		if policy.User.Enabled() && l.identify != nil {
+			if id := l.identify(r); id != "" {
+				if !l.allow(w, r, route, "user", id, policy.User) {
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow возвращает false, если ответ 429 уже записан
+func (l *Limiter) allow(w http.ResponseWriter, r *http.Request, route, kind, id string, rule Rule) bool {
+	ok, retryAfter, err := l.backend.Allow(r.Context(), "rl:"+route+":"+kind+":"+id, rule)
+	if err != nil {
+		slog.WarnContext(r.Context(), "ограничение частоты недоступно", "route", route, "err", err)
+		return true
+	}
+	if ok {
+		return true
+	}
+
+	metrics.RateLimited(route, kind)
+	slog.InfoContext(r.Context(), "слишком много запросов", "route", route, "key", kind, "retry_after", retryAfter)
+	// Обработчик не вызывается, поэтому маршрут для логов и метрик ставим сами
+	r.Pattern = route
+	tooManyRequests(w, r, retryAfter)
+	return false
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"error": "rate limit exceeded"})
+		return
+	}
+	http.Error(w, "Слишком много запросов, попробуйте через "+strconv.Itoa(seconds)+" с", http.StatusTooManyRequests)
+}
+
+// clientIP — адрес соединения или, за доверенным балансировщиком, последний адрес
+// в X-Forwarded-For: его дописал сам балансировщик, а более ранние мог подставить клиент
+func (l *Limiter) clientIP(r *http.Request) string {
+	if l.cfg.TrustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); net.ParseIP(ip) != nil {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
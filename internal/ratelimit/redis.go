@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTimeout — сколько запрос ждёт Redis, прежде чем пройти без ограничения
+const redisTimeout = 200 * time.Millisecond
+
+// RedisConfig — адрес Redis, общего для всех экземпляров сервиса
+type RedisConfig struct {
+	Addr     string `json:"addr"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+}
+
+// tokenBucket забирает токен атомарно, чтобы экземпляры не считали одну корзину наперегонки.
+// Время берётся у Redis — часы экземпляров могут расходиться.
+// KEYS[1] — корзина; ARGV: ёмкость, токенов в секунду. Ответ: {1|0, мс до токена}.
+var tokenBucket = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1]) or capacity
+local last = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + (now - last) / 1000 * rate)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate * 1000) + 1000)
+return {allowed, wait}
+`)
+
+// RedisBackend держит корзины в Redis, общие для всех экземпляров
+type RedisBackend struct {
+	client *redis.Client
+}
+
+func NewRedisBackend(cfg RedisConfig) (*RedisBackend, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("rate_limit.redis.addr is required for the redis backend")
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	return &RedisBackend{client: client}, nil
+}
+
+func (b *RedisBackend) Allow(ctx context.Context, key string, rule Rule) (bool, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	res, err := tokenBucket.Run(ctx, b.client, []string{key}, rule.capacity(), rule.perSecond()).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
+
+func (b *RedisBackend) Close() error {
+	return b.client.Close()
+}
@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"online_bank/internal/timeouts"
+)
+
+// Тест ходит в настоящий Redis: REDIS_ADDR=localhost:6379 go test ./internal/ratelimit/
+func TestRedisBackendAllow(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR не задан")
+	}
+	b, err := NewRedisBackend(RedisConfig{Addr: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	ctx := context.Background()
+	key := "rl:test:" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	defer b.client.Del(ctx, key)
+	rule := Rule{Requests: 2, Per: timeouts.Duration(time.Minute)}
+
+	for i := 0; i < 2; i++ {
+		ok, _, err := b.Allow(ctx, key, rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatalf("запрос %d отклонён в пределах ёмкости", i)
+		}
+	}
+
+	ok, wait, err := b.Allow(ctx, key, rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("запрос сверх ёмкости пропущен")
+	}
+	// Токен добавляется раз в 30 с; часть уже могла накопиться, пока шёл тест
+	if wait <= 29*time.Second || wait > 30*time.Second {
+		t.Fatalf("retry after = %v, want около 30s", wait)
+	}
+
+	if ttl := b.client.PTTL(ctx, key).Val(); ttl <= 0 || ttl > 61*time.Second {
+		t.Fatalf("ttl = %v: корзина должна истечь, когда наполнится", ttl)
+	}
+}
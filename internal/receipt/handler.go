@@ -0,0 +1,78 @@
+package receipt
+
+import (
+	"html/template"
+	"net/http"
+
+	"online_bank/internal/user"
+)
+
+type ReceiptHandler struct {
+	signer    *Signer
+	users     *user.UserService
+	templates *template.Template
+}
+
+func NewReceiptHandler(signer *Signer, users *user.UserService, templates *template.Template) *ReceiptHandler {
+	return &ReceiptHandler{signer: signer, users: users, templates: templates}
+}
+
+// ViewPage — квитанция для печати
+func (h *ReceiptHandler) ViewPage(w http.ResponseWriter, r *http.Request) {
+	rc, err := h.build(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	h.templates.ExecuteTemplate(w, "receipt.html", rc)
+}
+
+// PDFPage отдаёт ту же квитанцию файлом
+func (h *ReceiptHandler) PDFPage(w http.ResponseWriter, r *http.Request) {
+	rc, err := h.build(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="receipt-`+rc.Reference+`.pdf"`)
+	if err := WritePDF(w, rc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// VerifyPage — публичная проверка квитанции по номеру и коду. Показывает только
+// сумму, дату и текущий статус, без данных сторон.
+func (h *ReceiptHandler) VerifyPage(w http.ResponseWriter, r *http.Request) {
+	ref, code := r.FormValue("ref"), r.FormValue("code")
+	data := map[string]interface{}{"Ref": ref, "Code": code}
+
+	if ref != "" && code != "" {
+		t, err := h.users.FindTransaction(r.Context(), ref)
+		valid := err == nil && h.signer.Verify(t, code)
+		data["Checked"] = true
+		data["Valid"] = valid
+		if valid {
+			owner, err := h.users.GetBalance(r.Context(), t.UserID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			data["Receipt"] = New(t, owner)
+		}
+	}
+
+	h.templates.ExecuteTemplate(w, "receipt_verify.html", data)
+}
+
+func (h *ReceiptHandler) build(r *http.Request) (*Receipt, error) {
+	u := user.CurrentUser(r.Context())
+	t, err := h.users.GetTransaction(r.Context(), u.ID, r.FormValue("ref"))
+	if err != nil {
+		return nil, err
+	}
+	rc := New(t, u)
+	rc.Code = h.signer.Code(t)
+	return rc, nil
+}
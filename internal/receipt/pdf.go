@@ -0,0 +1,67 @@
+package receipt
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// Встроенные шрифты fpdf не содержат кириллицы, поэтому берём DejaVu
+// (свободная лицензия Bitstream Vera)
+var (
+	//go:embed fonts/DejaVuSansCondensed.ttf
+	fontRegular []byte
+	//go:embed fonts/DejaVuSansCondensed-Bold.ttf
+	fontBold []byte
+)
+
+// WritePDF выводит квитанцию одной страницей A5
+func WritePDF(w io.Writer, r *Receipt) error {
+	pdf := fpdf.New("P", "mm", "A5", "")
+	pdf.SetTitle("Квитанция "+r.Reference, true)
+	pdf.AddUTF8FontFromBytes("DejaVu", "", fontRegular)
+	pdf.AddUTF8FontFromBytes("DejaVu", "B", fontBold)
+	pdf.AddPage()
+
+	pdf.SetFont("DejaVu", "B", 16)
+	pdf.CellFormat(0, 10, "Квитанция", "", 1, "C", false, 0, "")
+	pdf.SetFont("DejaVu", "", 10)
+	pdf.CellFormat(0, 6, "№ "+r.Reference, "", 1, "C", false, 0, "")
+	pdf.Ln(4)
+
+	row := func(label, value string) {
+		pdf.SetFont("DejaVu", "B", 10)
+		pdf.CellFormat(40, 8, label, "B", 0, "L", false, 0, "")
+		pdf.SetFont("DejaVu", "", 10)
+		pdf.MultiCell(0, 8, value, "B", "L", false)
+	}
+
+	row("Дата", r.CreatedAt.Format("02.01.2006 15:04:05"))
+	row("Тип", r.Type)
+	row("Статус", r.Status)
+	row("Плательщик", partyName(r.Payer))
+	row("Получатель", partyName(r.Payee))
+	row("Сумма", fmt.Sprintf("%.2f %s", r.Amount, r.Currency))
+	row("Комиссия", fmt.Sprintf("%.2f %s", r.Fee, r.Currency))
+	if r.Rate != 0 {
+		row("Курс", fmt.Sprintf("%.6f", r.Rate))
+	}
+	row("Описание", r.Description)
+
+	pdf.Ln(6)
+	pdf.SetFont("DejaVu", "B", 12)
+	pdf.CellFormat(0, 8, "Код проверки: "+r.Code, "", 1, "C", false, 0, "")
+	pdf.SetFont("DejaVu", "", 8)
+	pdf.MultiCell(0, 5, "Подлинность квитанции можно проверить на странице /receipt/verify по номеру операции и коду проверки.", "", "C", false)
+
+	return pdf.Output(w)
+}
+
+func partyName(p Party) string {
+	if p.ID == 0 {
+		return "—"
+	}
+	return fmt.Sprintf("%s (ID: %d)", p.Name, p.ID)
+}
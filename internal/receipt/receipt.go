@@ -0,0 +1,121 @@
+package receipt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"online_bank/internal/user"
+)
+
+// Party — сторона операции в квитанции. ID == 0 означает, что стороны нет (например, у пополнения).
+type Party struct {
+	ID   int
+	Name string
+}
+
+// Receipt — данные квитанции по одной записи из истории операций
+type Receipt struct {
+	Reference   string
+	CreatedAt   time.Time
+	Type        string
+	Status      string
+	Payer       Party
+	Payee       Party
+	Amount      float64
+	Currency    string
+	Fee         float64
+	Rate        float64
+	Description string
+	Code        string
+}
+
+var typeNames = map[string]string{
+	"deposit":    "Пополнение",
+	"transfer":   "Перевод",
+	"conversion": "Конвертация",
+	"fee":        "Комиссия",
+	"fee_income": "Доход от комиссии",
+	"refund":     "Возврат",
+	"reversal":   "Отмена операции",
+	"adjustment": "Корректировка",
+}
+
+var statusNames = map[string]string{
+	user.StatusCompleted:         "Выполнена",
+	user.StatusReversed:          "Отменена",
+	user.StatusPartiallyRefunded: "Частично возвращена",
+	user.StatusRefunded:          "Возвращена",
+}
+
+// New собирает квитанцию по записи владельца: списание — владелец платит контрагенту,
+// зачисление — наоборот
+func New(t *user.Transactions, owner *user.User) *Receipt {
+	r := &Receipt{
+		Reference:   t.Reference,
+		CreatedAt:   t.CreatedAt,
+		Type:        name(typeNames, t.TType),
+		Status:      name(statusNames, t.Status),
+		Amount:      math.Abs(t.Amount),
+		Currency:    t.Currency,
+		Fee:         t.Fee,
+		Rate:        t.Rate,
+		Description: t.Description,
+	}
+
+	self := Party{ID: owner.ID, Name: owner.Name}
+	other := Party{ID: t.CounterpartyID, Name: t.CounterpartyName}
+	if t.Amount < 0 {
+		r.Payer, r.Payee = self, other
+	} else {
+		r.Payer, r.Payee = other, self
+	}
+	if t.TType == "conversion" {
+		r.Payer, r.Payee = self, self
+	}
+	return r
+}
+
+func name(names map[string]string, key string) string {
+	if n, ok := names[key]; ok {
+		return n
+	}
+	return key
+}
+
+// Signer выдаёт коды проверки квитанций. Код — HMAC от номера, владельца, суммы,
+// валюты и времени операции, поэтому подделать квитанцию с другой суммой не получится.
+type Signer struct {
+	secret []byte
+}
+
+func NewSigner(secret []byte) *Signer {
+	return &Signer{secret: secret}
+}
+
+// Code — код вида 1A2B-3C4D-5E6F-7A8B
+func (s *Signer) Code(t *user.Transactions) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s|%d|%.2f|%s|%d", t.Reference, t.UserID, t.Amount, t.Currency, t.CreatedAt.Unix())
+	sum := strings.ToUpper(hex.EncodeToString(mac.Sum(nil))[:16])
+	return sum[0:4] + "-" + sum[4:8] + "-" + sum[8:12] + "-" + sum[12:16]
+}
+
+// Verify сравнивает код из квитанции с ожидаемым; регистр, пробелы и дефисы не важны
+func (s *Signer) Verify(t *user.Transactions, code string) bool {
+	return hmac.Equal([]byte(normalize(code)), []byte(normalize(s.Code(t))))
+}
+
+func normalize(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
@@ -0,0 +1,120 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"online_bank/internal/user"
+)
+
+const formTime = "2006-01-02T15:04"
+
+type ScheduleHandler struct {
+	service   *ScheduleService
+	users     *user.UserService
+	templates *template.Template
+}
+
+func NewScheduleHandler(service *ScheduleService, users *user.UserService, templates *template.Template) *ScheduleHandler {
+	return &ScheduleHandler{service: service, users: users, templates: templates}
+}
+
+func (h *ScheduleHandler) ListPage(w http.ResponseWriter, r *http.Request) {
+	userID := user.CurrentUser(r.Context()).ID
+
+	if r.Method == http.MethodPost {
+		if err := h.create(r, userID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "/scheduled", http.StatusSeeOther)
+		return
+	}
+
+	list, err := h.service.List(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recipients, err := h.users.GetAllUsersExcept(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.templates.ExecuteTemplate(w, "scheduled.html", map[string]interface{}{
+		"Transfers":  list,
+		"Recipients": recipients,
+		"Now":        time.Now().Add(time.Minute).Format(formTime),
+	})
+}
+
+func (h *ScheduleHandler) create(r *http.Request, userID int) error {
+	toID, err := strconv.Atoi(r.FormValue("to_id"))
+	if err != nil {
+		return errors.New("invalid recipient ID")
+	}
+	amount, err := strconv.ParseFloat(r.FormValue("amount"), 64)
+	if err != nil {
+		return errors.New("invalid amount")
+	}
+	start, err := time.ParseInLocation(formTime, r.FormValue("start"), time.Local)
+	if err != nil {
+		return errors.New("invalid start time")
+	}
+
+	var endDate time.Time
+	if v := r.FormValue("end_date"); v != "" {
+		endDate, err = time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return errors.New("invalid end date")
+		}
+		// Дата окончания включительно
+		endDate = endDate.AddDate(0, 0, 1).Add(-time.Second)
+	}
+
+	var count int
+	if v := r.FormValue("count"); v != "" {
+		count, err = strconv.Atoi(v)
+		if err != nil {
+			return errors.New("invalid count")
+		}
+	}
+
+	return h.service.Create(r.Context(), userID, toID, amount, r.FormValue("currency"), r.FormValue("frequency"), start, endDate, count)
+}
+
+func (h *ScheduleHandler) PausePage(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, h.service.Pause)
+}
+
+func (h *ScheduleHandler) ResumePage(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, h.service.Resume)
+}
+
+func (h *ScheduleHandler) CancelPage(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, h.service.Cancel)
+}
+
+func (h *ScheduleHandler) changeStatus(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, id, userID int) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := action(r.Context(), id, user.CurrentUser(r.Context()).ID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/scheduled", http.StatusSeeOther)
+}
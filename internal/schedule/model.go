@@ -0,0 +1,54 @@
+package schedule
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	FrequencyOnce    = "once"
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+
+	StatusActive    = "active"
+	StatusPaused    = "paused"
+	StatusCancelled = "cancelled"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+type ScheduledTransfer struct {
+	ID            int
+	UserID        int
+	ToID          int
+	ToName        string
+	Amount        float64
+	Currency      string
+	Frequency     string
+	NextRunAt     time.Time
+	EndDate       sql.NullTime
+	RemainingRuns sql.NullInt64
+	Status        string
+	Attempts      int
+	LastError     string
+	LastRunAt     sql.NullTime
+	CreatedAt     time.Time
+
+	// ScheduledAt — плановое время текущего периода. NextRunAt совпадает с ним,
+	// пока запуск не отложен повтором после ошибки.
+	ScheduledAt time.Time
+}
+
+// next возвращает время следующего запуска после t
+func (s *ScheduledTransfer) next(t time.Time) time.Time {
+	switch s.Frequency {
+	case FrequencyDaily:
+		return t.AddDate(0, 0, 1)
+	case FrequencyWeekly:
+		return t.AddDate(0, 0, 7)
+	case FrequencyMonthly:
+		return t.AddDate(0, 1, 0)
+	}
+	return t
+}
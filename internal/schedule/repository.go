@@ -0,0 +1,170 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"online_bank/internal/pii"
+	"online_bank/internal/timeouts"
+
+	"github.com/lib/pq"
+)
+
+type ScheduleRepository struct {
+	db       *sql.DB
+	timeouts timeouts.Config
+	// pii расшифровывает имена пользователей
+	pii *pii.Cipher
+}
+
+func NewScheduleRepository(db *sql.DB, t timeouts.Config, cipher *pii.Cipher) *ScheduleRepository {
+	return &ScheduleRepository{db: db, timeouts: t, pii: cipher}
+}
+
+func (r *ScheduleRepository) Create(ctx context.Context, s *ScheduledTransfer) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "schedule.Create")
+	defer cancel()
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO scheduled_transfers (user_id, to_id, amount, currency, frequency, next_run_at,
+			scheduled_at, end_date, remaining_runs, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, s.UserID, s.ToID, s.Amount, s.Currency, s.Frequency, s.NextRunAt,
+		s.EndDate, s.RemainingRuns, StatusActive, time.Now()).Scan(&s.ID)
+}
+
+func (r *ScheduleRepository) ListByUser(ctx context.Context, userID int) ([]*ScheduledTransfer, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "schedule.ListByUser")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+columns+`
+		FROM scheduled_transfers s JOIN users u ON u.id = s.to_id
+		WHERE s.user_id = $1
+		ORDER BY s.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return r.scanAll(ctx, rows)
+}
+
+// Claim забирает активные задания, время которых наступило, и до now+lease скрывает их
+// от других воркеров. SKIP LOCKED не даёт двум экземплярам взять одну строку одновременно,
+// а срок аренды возвращает задание в очередь, если взявший его процесс упал.
+func (r *ScheduleRepository) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*ScheduledTransfer, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "schedule.Claim")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		WITH claimed AS (
+			UPDATE scheduled_transfers SET locked_until = $1
+			WHERE id IN (
+				SELECT id FROM scheduled_transfers
+				WHERE status = $2 AND next_run_at <= $3 AND (locked_until IS NULL OR locked_until <= $3)
+				ORDER BY next_run_at
+				LIMIT $4
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT `+columns+`
+		FROM claimed s JOIN users u ON u.id = s.to_id
+		ORDER BY s.next_run_at
+	`, now.Add(lease), StatusActive, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return r.scanAll(ctx, rows)
+}
+
+// ChangeStatus меняет статус задания пользователя, если текущий статус входит в from
+func (r *ScheduleRepository) ChangeStatus(ctx context.Context, id, userID int, to string, from ...string) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "schedule.ChangeStatus")
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE scheduled_transfers SET status = $1
+		WHERE id = $2 AND user_id = $3 AND status = ANY($4)
+	`, to, id, userID, pq.Array(from))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("scheduled transfer not found")
+	}
+	return nil
+}
+
+// errChanged — задание поставили на паузу, отменили или уже провели этот период
+var errChanged = errors.New("scheduled transfer changed during the run")
+
+// Advance сохраняет успешный запуск в транзакции перевода. Строка меняется, только если
+// задание всё ещё активно и ждёт периода scheduledAt; иначе возвращается errChanged,
+// и перевод откатывается — так один период не оплачивается дважды.
+func (r *ScheduleRepository) Advance(ctx context.Context, tx *sql.Tx, s *ScheduledTransfer, scheduledAt time.Time) error {
+	return r.save(ctx, tx, s, scheduledAt)
+}
+
+// SaveRun сохраняет неудачный запуск. Как и Advance, не перезаписывает паузу или отмену,
+// сделанную во время перевода.
+func (r *ScheduleRepository) SaveRun(ctx context.Context, s *ScheduledTransfer, scheduledAt time.Time) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "schedule.SaveRun")
+	defer cancel()
+	err := r.save(ctx, r.db, s, scheduledAt)
+	if errors.Is(err, errChanged) {
+		return nil
+	}
+	return err
+}
+
+// execer — *sql.DB или *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (r *ScheduleRepository) save(ctx context.Context, q execer, s *ScheduledTransfer, scheduledAt time.Time) error {
+	res, err := q.ExecContext(ctx, `
+		UPDATE scheduled_transfers
+		SET next_run_at = $1, scheduled_at = $2, remaining_runs = $3, status = $4, attempts = $5,
+			last_error = $6, last_run_at = $7, locked_until = NULL
+		WHERE id = $8 AND status = $9 AND scheduled_at = $10
+	`, s.NextRunAt, s.ScheduledAt, s.RemainingRuns, s.Status, s.Attempts, s.LastError, s.LastRunAt,
+		s.ID, StatusActive, scheduledAt)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errChanged
+	}
+	return nil
+}
+
+const columns = `s.id, s.user_id, s.to_id, u.name, s.amount, s.currency, s.frequency, s.next_run_at,
+	s.end_date, s.remaining_runs, s.status, s.attempts, s.last_error, s.last_run_at, s.created_at, s.scheduled_at`
+
+func (r *ScheduleRepository) scanAll(ctx context.Context, rows *sql.Rows) ([]*ScheduledTransfer, error) {
+	var list []*ScheduledTransfer
+	for rows.Next() {
+		s := &ScheduledTransfer{}
+		err := rows.Scan(&s.ID, &s.UserID, &s.ToID, &s.ToName, &s.Amount, &s.Currency, &s.Frequency, &s.NextRunAt,
+			&s.EndDate, &s.RemainingRuns, &s.Status, &s.Attempts, &s.LastError, &s.LastRunAt, &s.CreatedAt, &s.ScheduledAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.pii.DecryptAll(ctx, pii.Field{Column: pii.UserName, RowID: s.ToID, Value: &s.ToName}); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
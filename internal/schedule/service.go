@@ -0,0 +1,218 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"online_bank/internal/currency"
+	"online_bank/internal/events"
+	"online_bank/internal/logging"
+	"online_bank/internal/user"
+)
+
+const (
+	// maxAttempts — сколько раз повторять неудавшийся запуск, прежде чем сдаться
+	maxAttempts = 3
+	retryDelay  = time.Hour
+	// claimLease — на сколько воркер забирает задание; за это время запуск должен завершиться
+	claimLease = 5 * time.Minute
+)
+
+// Transferer выполняет перевод; реализуется user.UserService
+type Transferer interface {
+	TransferWith(ctx context.Context, fromID, toID int, amount float64, cur string, opts user.TransferOptions) error
+	// ValidateRecipient проверяет получателя так же, как перевод
+	ValidateRecipient(ctx context.Context, toID int) (*user.User, error)
+}
+
+// Notifier сообщает владельцу задания о результате запуска;
+// реализуется notification.NotificationService
+type Notifier interface {
+	Notify(ctx context.Context, userID int, kind, message string)
+}
+
+type ScheduleService struct {
+	repo      *ScheduleRepository
+	transfers Transferer
+	notifier  Notifier
+}
+
+func NewScheduleService(repo *ScheduleRepository, transfers Transferer, notifier Notifier) *ScheduleService {
+	return &ScheduleService{repo: repo, transfers: transfers, notifier: notifier}
+}
+
+// Create заводит перевод. count и endDate ограничивают повторы (0 и нулевое время — без ограничения).
+func (s *ScheduleService) Create(ctx context.Context, userID, toID int, amount float64, cur, frequency string, start, endDate time.Time, count int) error {
+	if amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if !currency.IsSupported(cur) {
+		return errors.New("unsupported currency")
+	}
+	if userID == toID {
+		return errors.New("cannot transfer to yourself")
+	}
+	switch frequency {
+	case FrequencyOnce, FrequencyDaily, FrequencyWeekly, FrequencyMonthly:
+	default:
+		return errors.New("invalid frequency")
+	}
+	if start.Before(time.Now().Add(-time.Minute)) {
+		return errors.New("start time is in the past")
+	}
+	if !endDate.IsZero() && endDate.Before(start) {
+		return errors.New("end date is before start time")
+	}
+	if count < 0 {
+		return errors.New("count must not be negative")
+	}
+	// Получателя, на которого перевод не пройдёт, видно сразу, а не при первом запуске
+	if _, err := s.transfers.ValidateRecipient(ctx, toID); err != nil {
+		return err
+	}
+
+	st := &ScheduledTransfer{
+		UserID:    userID,
+		ToID:      toID,
+		Amount:    amount,
+		Currency:  cur,
+		Frequency: frequency,
+		NextRunAt: start,
+	}
+	if !endDate.IsZero() {
+		st.EndDate = sql.NullTime{Time: endDate, Valid: true}
+	}
+	if count > 0 {
+		st.RemainingRuns = sql.NullInt64{Int64: int64(count), Valid: true}
+	}
+	return s.repo.Create(ctx, st)
+}
+
+func (s *ScheduleService) List(ctx context.Context, userID int) ([]*ScheduledTransfer, error) {
+	return s.repo.ListByUser(ctx, userID)
+}
+
+func (s *ScheduleService) Pause(ctx context.Context, id, userID int) error {
+	return s.repo.ChangeStatus(ctx, id, userID, StatusPaused, StatusActive)
+}
+
+func (s *ScheduleService) Resume(ctx context.Context, id, userID int) error {
+	return s.repo.ChangeStatus(ctx, id, userID, StatusActive, StatusPaused)
+}
+
+func (s *ScheduleService) Cancel(ctx context.Context, id, userID int) error {
+	return s.repo.ChangeStatus(ctx, id, userID, StatusCancelled, StatusActive, StatusPaused)
+}
+
+// RunWorker раз в interval выполняет наступившие переводы, пока не отменён ctx
+func (s *ScheduleService) RunWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Каждый проход получает свой идентификатор, как HTTP-запрос.
+		// Начатый проход доводится до конца и при остановке сервера.
+		s.runDue(logging.WithRequestID(context.WithoutCancel(ctx), logging.NewID()), time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *ScheduleService) runDue(ctx context.Context, now time.Time) {
+	due, err := s.repo.Claim(ctx, now, claimLease, 100)
+	if err != nil {
+		slog.ErrorContext(ctx, "не удалось получить запланированные переводы", "err", err)
+		return
+	}
+
+	for _, st := range due {
+		s.run(ctx, st, now)
+	}
+}
+
+// run выполняет один запуск и переводит задание в следующее состояние.
+// Успешный запуск сохраняется в транзакции перевода, поэтому период не оплачивается дважды
+// ни при сбое сохранения, ни при паузе или отмене во время перевода.
+func (s *ScheduleService) run(ctx context.Context, st *ScheduledTransfer, now time.Time) {
+	scheduledAt := st.ScheduledAt
+	st.LastRunAt = sql.NullTime{Time: now, Valid: true}
+
+	next := *st
+	next.Attempts = 0
+	next.LastError = ""
+	s.advance(&next, now)
+	err := s.transfers.TransferWith(ctx, st.UserID, st.ToID, st.Amount, st.Currency, user.TransferOptions{
+		InTx: func(ctx context.Context, tx *sql.Tx) error {
+			return s.repo.Advance(ctx, tx, &next, scheduledAt)
+		},
+	})
+	if err == nil {
+		*st = next
+		return
+	}
+	if errors.Is(err, errChanged) {
+		slog.InfoContext(ctx, "запланированный перевод изменён во время запуска", "scheduled_id", st.ID)
+		return
+	}
+
+	st.Attempts++
+	st.LastError = err.Error()
+	if st.Attempts < maxAttempts {
+		// Повтор сдвигает только NextRunAt: плановое время периода остаётся прежним
+		st.NextRunAt = now.Add(retryDelay)
+		s.save(ctx, st, scheduledAt)
+		return
+	}
+
+	// Попытки исчерпаны: разовый перевод считается проваленным,
+	// у повторяющегося пропускается только текущий платёж
+	st.Attempts = 0
+	if st.Frequency == FrequencyOnce {
+		st.Status = StatusFailed
+	} else {
+		s.advance(st, now)
+	}
+	s.save(ctx, st, scheduledAt)
+	s.notifier.Notify(ctx, st.UserID, events.KindScheduledFailed, fmt.Sprintf(
+		"Запланированный перевод %.2f %s пользователю %s не выполнен: %s",
+		st.Amount, st.Currency, st.ToName, err))
+}
+
+func (s *ScheduleService) save(ctx context.Context, st *ScheduledTransfer, scheduledAt time.Time) {
+	if err := s.repo.SaveRun(ctx, st, scheduledAt); err != nil {
+		slog.ErrorContext(ctx, "не удалось сохранить запуск перевода", "scheduled_id", st.ID, "err", err)
+	}
+}
+
+// advance переносит задание на следующий период или завершает его.
+// Следующий период считается от планового времени, а не от сдвинутого повтором NextRunAt.
+func (s *ScheduleService) advance(st *ScheduledTransfer, now time.Time) {
+	if st.RemainingRuns.Valid {
+		st.RemainingRuns.Int64--
+	}
+
+	next := st.next(st.ScheduledAt)
+	// После долгого простоя не догоняем пропущенные периоды
+	for st.Frequency != FrequencyOnce && !next.After(now) {
+		next = st.next(next)
+	}
+	st.ScheduledAt = next
+	st.NextRunAt = next
+
+	switch {
+	case st.Frequency == FrequencyOnce:
+		st.Status = StatusCompleted
+	case st.RemainingRuns.Valid && st.RemainingRuns.Int64 <= 0:
+		st.Status = StatusCompleted
+	case st.EndDate.Valid && next.After(st.EndDate.Time):
+		st.Status = StatusCompleted
+	}
+}
@@ -0,0 +1,4 @@
+// Кнопки с data-print открывают диалог печати
+document.querySelectorAll("[data-print]").forEach(function (el) {
+    el.addEventListener("click", function () { window.print(); });
+});
@@ -0,0 +1,35 @@
+package static
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// Prefix — путь, по которому раздаются файлы
+const Prefix = "/static/"
+
+// Bootstrap и свои стили и скрипты лежат в бинарнике, чтобы CSP не пускал сторонние домены
+//
+//go:embed files
+var files embed.FS
+
+// Handler раздаёт встроенные файлы по Prefix
+func Handler() http.Handler {
+	sub, err := fs.Sub(files, "files")
+	if err != nil {
+		panic(err)
+	}
+	fileServer := http.StripPrefix(Prefix, http.FileServerFS(sub))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Список файлов не показываем
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		// У встроенных файлов нет даты изменения, поэтому кешируем на сутки
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		fileServer.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,67 @@
+package timeouts
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// DefaultTimeout — сколько по умолчанию может длиться одна операция с БД
+const DefaultTimeout = 5 * time.Second
+
+// builtin — операции, которым по умолчанию нужно больше времени
+var builtin = map[string]time.Duration{
+	// Проверка цепочки журнала аудита читает его целиком
+	"audit.All":    2 * time.Minute,
+	"outbox.Purge": time.Minute,
+}
+
+// Config — ограничения времени на операции с БД из config.json:
+//
+//	"db_timeouts": {"default": "5s", "operations": {"user.Transfer": "15s"}}
+//
+// Ключ операции — пакет и метод репозитория: "user.Transfer", "audit.All".
+type Config struct {
+	Default    Duration            `json:"default"`
+	Operations map[string]Duration `json:"operations"`
+}
+
+// For возвращает ограничение для операции op
+func (c Config) For(op string) time.Duration {
+	if d, ok := c.Operations[op]; ok && d > 0 {
+		return time.Duration(d)
+	}
+	if d, ok := builtin[op]; ok {
+		return d
+	}
+	if c.Default > 0 {
+		return time.Duration(c.Default)
+	}
+	return DefaultTimeout
+}
+
+// Apply ограничивает ctx временем операции op. Отмена запроса клиентом
+// по-прежнему прерывает операцию раньше.
+func (c Config) Apply(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, c.For(op))
+}
+
+// Duration читается из JSON строкой вида "1.5s" или "2m"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Connector оборачивает драйвер БД: каждый запрос и коммит транзакции получает свой спан
+// с текстом SQL. Параметры запроса в спан не пишутся — в них бывают персональные данные.
+// Запросы без контекста (db.Exec вместо db.ExecContext) становятся отдельными трассами.
+func Connector(c driver.Connector) driver.Connector {
+	return &connector{c}
+}
+
+type connector struct {
+	driver.Connector
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	cn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{cn}, nil
+}
+
+// conn пробрасывает интерфейсы database/sql/driver, которые реализует lib/pq
+type conn struct {
+	driver.Conn
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startSQL(ctx, query)
+	res, err := execer.ExecContext(ctx, query, args)
+	endSQL(span, err)
+	return res, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startSQL(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	endSQL(span, err)
+	return rows, err
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	b, ok := c.Conn.(driver.ConnBeginTx)
+	if !ok {
+		return c.Conn.Begin()
+	}
+	spanCtx, span := startSQL(ctx, "BEGIN")
+	t, err := b.BeginTx(spanCtx, opts)
+	endSQL(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: t, ctx: ctx}, nil
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// tx помнит контекст BeginTx: у Commit и Rollback своего контекста нет
+type tx struct {
+	driver.Tx
+	ctx context.Context
+}
+
+func (t *tx) Commit() error {
+	_, span := startSQL(t.ctx, "COMMIT")
+	err := t.Tx.Commit()
+	endSQL(span, err)
+	return err
+}
+
+func (t *tx) Rollback() error {
+	_, span := startSQL(t.ctx, "ROLLBACK")
+	err := t.Tx.Rollback()
+	endSQL(span, err)
+	return err
+}
+
+func startSQL(ctx context.Context, query string) (context.Context, trace.Span) {
+	return Start(ctx, "sql "+operation(query),
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.statement", strings.TrimSpace(query)),
+	)
+}
+
+func endSQL(span trace.Span, err error) {
+	if err == driver.ErrSkip {
+		err = nil
+	}
+	End(span, &err)
+}
+
+// operation — первое слово запроса: SELECT, INSERT, UPDATE ...
+func operation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,74 @@
+package user
+
+import (
+	"context"
+	"net/http"
+)
+
+type ctxKey int
+
+const currentUserKey ctxKey = iota
+
+// CurrentUser возвращает пользователя, положенного в контекст RequireRole
+func CurrentUser(ctx context.Context) *User {
+	u, _ := ctx.Value(currentUserKey).(*User)
+	return u
+}
+
+// WithUser кладёт пользователя в контекст — для других способов входа, например по API-ключу
+func WithUser(ctx context.Context, u *User) context.Context {
+	return context.WithValue(ctx, currentUserKey, u)
+}
+
+// RequireLogin пропускает запрос любому вошедшему пользователю
+func (h *UserHandler) RequireLogin(next http.HandlerFunc) http.HandlerFunc {
+	return h.requireUser(next, nil)
+}
+
+// RequireRole пропускает запрос только вошедшему пользователю с одной из ролей roles
+func (h *UserHandler) RequireRole(next http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return h.requireUser(next, roles)
+}
+
+// RequireKYC пропускает запрос только пользователю с подтверждённой личностью не ниже level;
+// остальных отправляет на /kyc
+func (h *UserHandler) RequireKYC(next http.HandlerFunc, level string) http.HandlerFunc {
+	return h.requireUser(func(w http.ResponseWriter, r *http.Request) {
+		if !KYCAtLeast(CurrentUser(r.Context()).KYCLevel, level) {
+			http.Redirect(w, r, "/kyc?need="+level, http.StatusSeeOther)
+			return
+		}
+		next(w, r)
+	}, nil)
+}
+
+func (h *UserHandler) requireUser(next http.HandlerFunc, roles []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := h.getUserIDFromCookie(r)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		u, err := h.service.GetBalance(r.Context(), userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if roles != nil && !hasRole(u, roles) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(WithUser(r.Context(), u)))
+	}
+}
+
+func hasRole(u *User, roles []string) bool {
+	for _, role := range roles {
+		if u.Role == role {
+			return true
+		}
+	}
+	return false
+}
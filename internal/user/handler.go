@@ -1,23 +1,47 @@
 package user
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
+	"online_bank/internal/audit"
+	"online_bank/internal/logging"
+	"online_bank/internal/security"
 )
 
 type UserHandler struct {
 	service   *UserService
+	audit     *audit.AuditService
 	templates *template.Template
+	sessions  SessionConfig
+	sections  map[string]DashboardSection
 }
 
-func NewUserHandler(service *UserService, templates *template.Template) *UserHandler {
-	return &UserHandler{service: service, templates: templates}
+// DashboardSection отдаёт данные для блока другого модуля на главной странице
+type DashboardSection func(ctx context.Context, userID int) (interface{}, error)
+
+type dashboardPage struct {
+	*User
+	Sections map[string]interface{}
+	// Nonce разрешает встроенный скрипт страницы по CSP
+	Nonce string
+}
+
+func NewUserHandler(service *UserService, audit *audit.AuditService, templates *template.Template, sessions SessionConfig) *UserHandler {
+	return &UserHandler{service: service, audit: audit, templates: templates, sessions: sessions, sections: map[string]DashboardSection{}}
+}
+
+// AddDashboardSection регистрирует блок name; в dashboard.html он доступен как index .Sections name
+func (h *UserHandler) AddDashboardSection(name string, section DashboardSection) {
+	h.sections[name] = section
 }
 
 func (h *UserHandler) RegisterPage(w http.ResponseWriter, r *http.Request) {
@@ -31,7 +55,7 @@ func (h *UserHandler) RegisterPage(w http.ResponseWriter, r *http.Request) {
 		email := r.FormValue("email")
 		password := r.FormValue("password")
 
-		err := h.service.Register(name, email, password)
+		err := h.service.Register(r.Context(), name, email, password)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -46,9 +70,11 @@ func (h *UserHandler) AboutPage(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
-	profile, err := h.service.GetProfile(userID)
+	profile, err := h.service.GetProfile(r.Context(), userID)
 	if err != nil {
-		log.Fatal(err)
+		slog.ErrorContext(r.Context(), "не удалось загрузить профиль", "err", err)
+		http.Error(w, "Не удалось загрузить профиль", http.StatusInternalServerError)
+		return
 	}
 	if r.Method == http.MethodGet {
 		h.templates.ExecuteTemplate(w, "about.html", profile)
@@ -73,14 +99,17 @@ func (h *UserHandler) AboutPage(w http.ResponseWriter, r *http.Request) {
 			defer dst.Close()
 			io.Copy(dst, file)
 		}
-		oldAvatar, err := h.service.GetAvatar(userID)
+		oldAvatar, err := h.service.GetAvatar(r.Context(), userID)
 		if err != nil{
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
 
-		err = h.service.UpProfile(name, bio, avatar_path, userID)
+		err = h.service.UpProfile(r.Context(), name, bio, avatar_path, userID)
+		// Журнал аудита не шифруется, поэтому в нём только список изменённых полей
+		h.record(r, userID, "profile.update", "user", userID, nil,
+			profileChanges(profile, &AboutPerson{Full_name: name, Bio: bio, Avatar_path: avatar_path}), err)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -89,7 +118,7 @@ func (h *UserHandler) AboutPage(w http.ResponseWriter, r *http.Request) {
 		if oldAvatar != ""  && oldAvatar != DefaultAvatar{
 			err := os.Remove(oldAvatar)
 		if err != nil {
-			log.Println("Не удалось удалить старый аватар:", err)
+			slog.WarnContext(r.Context(), "не удалось удалить старый аватар", "path", oldAvatar, "err", err)
 	}
 }
 
@@ -109,18 +138,17 @@ func (h *UserHandler) LoginPage(w http.ResponseWriter, r *http.Request) {
 		email := r.FormValue("email")
 		password := r.FormValue("password")
 
-		token, err := h.service.Login(email, password)
+		token, err := h.service.Login(r.Context(), email, password)
 		if err != nil {
+			h.record(r, 0, "auth.login", "user", 0, nil, map[string]string{"email": logging.MaskEmail(email)}, err)
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
+		if userID, err := h.service.GetUserIDByToken(r.Context(), token); err == nil {
+			h.record(r, userID, "auth.login", "user", userID, nil, nil, nil)
+		}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:     "auth_token",
-			Value:    token,
-			HttpOnly: true,
-			Path:     "/",
-		})
+		http.SetCookie(w, h.sessions.cookie(token))
 
 		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
 	}
@@ -134,17 +162,27 @@ func (h *UserHandler) DashboardPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.service.GetBalance(userID)
+	user, err := h.service.GetBalance(r.Context(), userID)
 	if err != nil{
 		http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 	}
-	user.Avatar_path, err = h.service.GetAvatar(userID)
+	user.Avatar_path, err = h.service.GetAvatar(r.Context(), userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	h.templates.ExecuteTemplate(w, "dashboard.html", user)
+
+	page := dashboardPage{User: user, Sections: map[string]interface{}{}, Nonce: security.Nonce(r.Context())}
+	for name, section := range h.sections {
+		data, err := section(r.Context(), userID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "не удалось загрузить блок дашборда", "section", name, "err", err)
+			continue
+		}
+		page.Sections[name] = data
+	}
+	h.templates.ExecuteTemplate(w, "dashboard.html", page)
 }
 
 func (h *UserHandler) DepositPage(w http.ResponseWriter, r *http.Request) {
@@ -167,7 +205,9 @@ func (h *UserHandler) DepositPage(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		err = h.service.Deposit(userID, amount)
+		before := h.balances(r.Context(), userID)
+		err = h.service.Deposit(r.Context(), userID, amount)
+		h.record(r, userID, "money.deposit", "user", userID, before, h.balances(r.Context(), userID), err)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -186,7 +226,7 @@ func (h *UserHandler) TransferPage(w http.ResponseWriter, r *http.Request) {
 	}
 
 
-	users, err := h.service.GetAllUsersExcept(fromID)
+	users, err := h.service.GetAllUsersExcept(r.Context(), fromID)
 	if err != nil {
 		http.Error(w, "failed to get users: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -200,6 +240,7 @@ func (h *UserHandler) TransferPage(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		toIDStr := r.FormValue("to_id")
 		amountStr := r.FormValue("amount")
+		cur := r.FormValue("currency")
 
 		toID, err := strconv.Atoi(toIDStr)
 		if err != nil {
@@ -213,7 +254,20 @@ func (h *UserHandler) TransferPage(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		err = h.service.Transfer(fromID, toID, amount)
+		// Первый POST показывает комиссию, второй (confirm=1) выполняет перевод
+		if r.FormValue("confirm") != "1" {
+			quote, err := h.service.QuoteTransfer(r.Context(), fromID, toID, amount, cur)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.templates.ExecuteTemplate(w, "transfer_confirm.html", quote)
+			return
+		}
+
+		before := h.balances(r.Context(), fromID)
+		err = h.service.Transfer(r.Context(), fromID, toID, amount, cur)
+		h.record(r, fromID, "money.transfer", "user", toID, before, h.balances(r.Context(), fromID), err)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -248,13 +302,25 @@ func (h *UserHandler) ConvertPage(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		rate, err := h.service.GetCurrencyRate(from, to)
+		if r.FormValue("confirm") != "1" {
+			quote, err := h.service.QuoteConversion(r.Context(), from, to, amount)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.templates.ExecuteTemplate(w, "convert_confirm.html", quote)
+			return
+		}
+
+		rate, err := h.service.GetCurrencyRate(r.Context(), from, to)
 		if err != nil {
 			http.Error(w, "failed to get currency rate: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		err = h.service.ConvertCurrency(userID, from, to, amount, rate)
+		before := h.balances(r.Context(), userID)
+		err = h.service.ConvertCurrency(r.Context(), userID, from, to, amount, rate)
+		h.record(r, userID, "money.convert", "user", userID, before, h.balances(r.Context(), userID), err)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -270,7 +336,7 @@ func (h *UserHandler) TransactionsPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.service.GetTransactions(userID)
+	user, err := h.service.GetTransactions(r.Context(), userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -279,28 +345,184 @@ func (h *UserHandler) TransactionsPage(w http.ResponseWriter, r *http.Request) {
 
 	h.templates.ExecuteTemplate(w, "transactions.html", user)
 }
+func (h *UserHandler) LimitsPage(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	statuses, err := h.service.GetLimits(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.templates.ExecuteTemplate(w, "limits.html", statuses)
+}
+
+// EventsPage — поток Server-Sent Events: новый баланс и текст уведомления
+// после каждой операции пользователя
+func (h *UserHandler) EventsPage(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	u := CurrentUser(r.Context())
+	ch, unsubscribe := h.service.Subscribe(u.ID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Комментарий раз в 25 секунд не даёт прокси закрыть простаивающее соединение
+	ping := time.NewTicker(25 * time.Second)
+	defer ping.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case e, ok := <-ch:
+			if !ok {
+				// Сервер останавливается — браузер переподключится сам
+				return
+			}
+			data, _ := json.Marshal(e)
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (h *UserHandler) TransactionPage(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	t, err := h.service.GetTransaction(r.Context(), userID, r.FormValue("ref"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	h.templates.ExecuteTemplate(w, "transaction.html", t)
+}
+
+func (h *UserHandler) RefundPage(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	txID, err := strconv.Atoi(r.FormValue("tx_id"))
+	if err != nil {
+		http.Error(w, "invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+	amount, err := strconv.ParseFloat(r.FormValue("amount"), 64)
+	if err != nil {
+		http.Error(w, "invalid amount", http.StatusBadRequest)
+		return
+	}
+	reason := r.FormValue("reason")
+
+	before := h.balances(r.Context(), userID)
+	orig, err := h.service.Refund(r.Context(), userID, txID, amount, reason)
+	targetID := 0
+	if orig != nil {
+		targetID = orig.CounterpartyID
+	}
+	h.record(r, userID, "money.refund", "user", targetID, before, h.balances(r.Context(), userID), err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/transactions", http.StatusSeeOther)
+}
+
 func (h *UserHandler) LogoutPage(w http.ResponseWriter, r *http.Request) {
 	h.Logout(w, r)
 }
 
 
+// SessionUserID возвращает пользователя, вошедшего через форму, — для middleware вне пакета
+func (h *UserHandler) SessionUserID(r *http.Request) (int, error) {
+	return h.getUserIDFromCookie(r)
+}
+
 func (h *UserHandler) getUserIDFromCookie(r *http.Request) (int, error) {
-	cookie, err := r.Cookie("auth_token")
+	token, err := h.sessions.token(r)
 	if err != nil {
 		return 0, err
 	}
 
-	return h.service.GetUserIDByToken(cookie.Value)
+	userID, err := h.service.GetUserIDByToken(r.Context(), token)
+	if err != nil {
+		return 0, err
+	}
+	logging.SetUserID(r.Context(), userID)
+	return userID, nil
+}
+
+// profileChanges — какие поля профиля изменились, без самих значений
+func profileChanges(before, after *AboutPerson) map[string][]string {
+	var changed []string
+	if before.Full_name != after.Full_name {
+		changed = append(changed, "full_name")
+	}
+	if before.Bio != after.Bio {
+		changed = append(changed, "bio")
+	}
+	if before.Avatar_path != after.Avatar_path {
+		changed = append(changed, "avatar")
+	}
+	return map[string][]string{"changed": changed}
+}
+
+// balances — снимок балансов для журнала аудита
+func (h *UserHandler) balances(ctx context.Context, userID int) map[string]float64 {
+	u, err := h.service.GetBalance(ctx, userID)
+	if err != nil {
+		return nil
+	}
+	return map[string]float64{"TJS": u.BalanceTJS, "USD": u.BalanceUSD, "EUR": u.BalanceEUR}
+}
+
+func (h *UserHandler) record(r *http.Request, actorID int, action, targetType string, targetID int, before, after interface{}, opErr error) {
+	err := h.audit.Record(r.Context(), audit.ActorFromRequest(r, actorID), action, targetType, targetID, before, after, opErr)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "не удалось записать в журнал аудита", "action", action, "err", err)
+	}
 }
 
 func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
-    http.SetCookie(w, &http.Cookie{
-        Name:     "auth_token",
-        Value:    "",
-        Path:     "/",
-        MaxAge:   -1, 
-        HttpOnly: true,
-    })
-    http.Redirect(w, r, "/login", http.StatusSeeOther)
+	if token, err := h.sessions.token(r); err == nil {
+		if err := h.service.Logout(r.Context(), token); err != nil {
+			slog.ErrorContext(r.Context(), "не удалось завершить сессию", "err", err)
+		}
+	}
+	http.SetCookie(w, h.sessions.cookie(""))
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
 
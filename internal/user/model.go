@@ -1,9 +1,47 @@
 package user
 
 import (
+	"math"
 	"time"
 )
 
+const (
+	StatusCompleted         = "completed"
+	StatusReversed          = "reversed"
+	StatusPartiallyRefunded = "partially_refunded"
+	StatusRefunded          = "refunded"
+)
+
+const (
+	RoleCustomer = "customer"
+	RoleSupport  = "support"
+	RoleAdmin    = "admin"
+)
+
+// Уровни проверки личности (KYC): без проверки, паспорт, паспорт и селфи
+const (
+	KYCUnverified = "unverified"
+	KYCBasic      = "basic"
+	KYCFull       = "full"
+)
+
+// KYCLevels — уровни по возрастанию
+var KYCLevels = []string{KYCUnverified, KYCBasic, KYCFull}
+
+// KYCAtLeast сообщает, не ниже ли уровень level, чем min
+func KYCAtLeast(level, min string) bool {
+	return kycRank(level) >= kycRank(min)
+}
+
+func kycRank(level string) int {
+	for i, l := range KYCLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
 type User struct {
 	ID        int       
 	Name      string    
@@ -14,14 +52,92 @@ type User struct {
 	BalanceEUR float64  
 	CreatedAt time.Time 
 	Avatar_path string
+	Role      string
+	Frozen    bool
+	Tier      string
+	KYCLevel  string
 }
 
 type Transactions struct{
+	ID int
+	Reference string
+	UserID int
 	TType string
 	Amount float64
 	Currency string
 	Description string
 	CreatedAt time.Time 
+	ReversalOf int
+	Reversed bool
+	CounterpartyID int
+	LinkedID int
+	RefundOf int
+	Refunded float64
+	CounterpartyName string
+	LinkedReference string
+	Status string
+	Rate float64
+	Fee float64
+	PaymentReference string
+	// FeeFor — операция, за которую списана эта комиссия
+	FeeFor int
+}
+
+// TransactionEvent — запись из истории операций в событиях для внешних получателей (вебхуков)
+type TransactionEvent struct {
+	Reference        string    `json:"reference"`
+	UserID           int       `json:"user_id"`
+	Type             string    `json:"type"`
+	Amount           float64   `json:"amount"`
+	Currency         string    `json:"currency"`
+	Fee              float64   `json:"fee,omitempty"`
+	Rate             float64   `json:"rate,omitempty"`
+	CounterpartyID   int       `json:"counterparty_id,omitempty"`
+	LinkedReference  string    `json:"linked_reference,omitempty"`
+	Description      string    `json:"description"`
+	PaymentReference string    `json:"payment_reference,omitempty"`
+	Status           string    `json:"status"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Event — данные записи для события об операции
+func (t *Transactions) Event() TransactionEvent {
+	return TransactionEvent{
+		Reference:        t.Reference,
+		UserID:           t.UserID,
+		Type:             t.TType,
+		Amount:           t.Amount,
+		Currency:         t.Currency,
+		Fee:              t.Fee,
+		Rate:             t.Rate,
+		CounterpartyID:   t.CounterpartyID,
+		LinkedReference:  t.LinkedReference,
+		Description:      t.Description,
+		PaymentReference: t.PaymentReference,
+		Status:           t.Status,
+		CreatedAt:        t.CreatedAt,
+	}
+}
+
+// Quote — расчёт операции, который показывается пользователю до подтверждения
+type Quote struct {
+	RecipientID   int
+	RecipientName string
+	Amount        float64
+	Currency      string
+	Fee           float64
+	Total         float64
+	ToCurrency    string
+	Rate          float64
+	Converted     float64
+	Reference     string
+	// PaymentCode — подписанный QR-код, по которому подтверждается оплата
+	PaymentCode string
+}
+
+// Refundable — сколько ещё можно вернуть по полученному переводу
+func (t *Transactions) Refundable() float64 {
+	return math.Round((t.Amount-t.Refunded)*100) / 100
 }
 
 type AboutPerson struct{
@@ -1,115 +1,206 @@
 package user
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
+	"online_bank/internal/currency"
+	"online_bank/internal/events"
+	"online_bank/internal/fee"
+	"online_bank/internal/limits"
+	"online_bank/internal/outbox"
+	"online_bank/internal/pii"
+	"online_bank/internal/timeouts"
+
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// UserRepository хранит имя, email, ФИО и «о себе» зашифрованными (pii.Cipher);
+// email ищется по слепому индексу email_index
 type UserRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts timeouts.Config
+	pii      *pii.Cipher
 }
 
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+func NewUserRepository(db *sql.DB, t timeouts.Config, cipher *pii.Cipher) *UserRepository {
+	return &UserRepository{db: db, timeouts: t, pii: cipher}
 }
 
 
 
-func (r *UserRepository) CreateUser(name, email, password string) error {
+func (r *UserRepository) CreateUser(ctx context.Context, name, email, password string) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.CreateUser")
+	defer cancel()
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
 
-	_, err = r.db.Exec(`
-		INSERT INTO users (name, email, password, balance_tjs, balance_usd, balance_eur, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`, name, email, string(hash), 100.0, 0.0, 0.0, time.Now())
-	if err != nil{
+	// Шифртекст привязан к id строки, поэтому id берётся до вставки
+	var userID int
+	if err := r.db.QueryRowContext(ctx, `SELECT nextval(pg_get_serial_sequence('users', 'id'))`).Scan(&userID); err != nil {
 		return err
 	}
-	user_ID, err := r.GetByEmail(email)
+	encName, err := r.pii.Encrypt(name, pii.UserName, userID)
+	if err != nil {
+		return err
+	}
+	encEmail, err := r.pii.Encrypt(email, pii.UserEmail, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO users (id, name, name_index, email, email_index, password, balance_tjs, balance_usd, balance_eur, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, userID, encName, r.pii.NameIndex(name), encEmail, r.pii.BlindIndex(email), string(hash), 0.0, 0.0, 0.0, time.Now())
 	if err != nil{
 		return err
 	}
-	err = r.CreateProfile(user_ID.ID, name)
+	err = r.CreateProfile(ctx, userID, name)
 	if err != nil{
 		return err
 	}
 	return nil
 }
 
-func (r *UserRepository) GetByEmail(email string) (*User, error) {
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.GetByEmail")
+	defer cancel()
 	u := &User{}
-	row := r.db.QueryRow(`
-		SELECT id, name, email, password, balance_tjs, balance_usd, balance_eur, created_at 
-		FROM users WHERE email = $1
-	`, email)
-	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Password, &u.BalanceTJS, &u.BalanceUSD, &u.BalanceEUR, &u.CreatedAt)
+	row := r.db.QueryRowContext(ctx, `
+		SELECT id, name, email, password, balance_tjs, balance_usd, balance_eur, created_at, role, frozen, tier, kyc_level
+		FROM users WHERE email_index = $1
+	`, r.pii.BlindIndex(email))
+	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Password, &u.BalanceTJS, &u.BalanceUSD, &u.BalanceEUR, &u.CreatedAt, &u.Role, &u.Frozen, &u.Tier, &u.KYCLevel)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
+	if err := r.pii.DecryptAll(ctx, userFields(u)...); err != nil {
+		return nil, err
+	}
 	return u, nil
 }
 
+func (r *UserRepository) GetEmail(ctx context.Context, userID int) (string, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.GetEmail")
+	defer cancel()
+	var email string
+	err := r.db.QueryRowContext(ctx, `SELECT email FROM users WHERE id = $1`, userID).Scan(&email)
+	if err != nil {
+		return "", err
+	}
+	return r.pii.Decrypt(ctx, email, pii.UserEmail, userID)
+}
+
 func (r *UserRepository) CheckPassword(u *User, password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	return err == nil
 }
 
-func (r *UserRepository) SaveToken(userID int, token string) error {
-	_, err := r.db.Exec(`
-		INSERT INTO user_tokens(token, user_id, created_at)
+// SaveToken сохраняет хеш токена входа; сам токен знает только браузер
+func (r *UserRepository) SaveToken(ctx context.Context, userID int, tokenHash string) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.SaveToken")
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_tokens(token_hash, user_id, created_at)
 		VALUES($1, $2, $3)
-	`, token, userID, time.Now())
+	`, tokenHash, userID, time.Now())
 	return err
 }
 
-func (r *UserRepository) GetUserIDByToken(token string) (int, error) {
+func (r *UserRepository) GetUserIDByToken(ctx context.Context, tokenHash string) (int, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.GetUserIDByToken")
+	defer cancel()
 	var userID int
-	err := r.db.QueryRow(`SELECT user_id FROM user_tokens WHERE token=$1`, token).Scan(&userID)
+	var stored string
+	err := r.db.QueryRowContext(ctx, `SELECT user_id, token_hash FROM user_tokens WHERE token_hash=$1`, tokenHash).Scan(&userID, &stored)
 	if err != nil {
 		return 0, err
 	}
+	// Индекс ищет по хешу, а не по токену, так что время поиска ничего не говорит о токене;
+	// итоговое сравнение всё равно делаем за постоянное время
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(tokenHash)) != 1 {
+		return 0, sql.ErrNoRows
+	}
 	return userID, nil
 }
-func (r *UserRepository) CreateProfile(id int, name string) error{
-	_, err := r.db.Exec(`
+
+// DeleteToken завершает сессию
+func (r *UserRepository) DeleteToken(ctx context.Context, tokenHash string) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.DeleteToken")
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `DELETE FROM user_tokens WHERE token_hash=$1`, tokenHash)
+	return err
+}
+func (r *UserRepository) CreateProfile(ctx context.Context, id int, name string) error{
+	ctx, cancel := r.timeouts.Apply(ctx, "user.CreateProfile")
+	defer cancel()
+	encName, err := r.pii.Encrypt(name, pii.ProfileFullName, id)
+	if err != nil {
+		return err
+	}
+	encBio, err := r.pii.Encrypt("Расскажите о себе", pii.ProfileBio, id)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
 		INSERT INTO profiles(user_id, full_name, bio, avatar_path, updated_at)
 		VALUES($1, $2, $3, $4, $5)
-	`, id, name, "Расскажите о себе", "uploads/default-avatar.jpg", time.Now())
+	`, id, encName, encBio, "uploads/default-avatar.jpg", time.Now())
 	return err
 }
 
-func (r *UserRepository)UpdateProfile(name, bio, avatar_path string, id int) error{
-	
-	_, err := r.db.Exec(`
+func (r *UserRepository) UpdateProfile(ctx context.Context, name, bio, avatar_path string, id int) error{
+	ctx, cancel := r.timeouts.Apply(ctx, "user.UpdateProfile")
+	defer cancel()
+	encName, err := r.pii.Encrypt(name, pii.ProfileFullName, id)
+	if err != nil {
+		return err
+	}
+	encBio, err := r.pii.Encrypt(bio, pii.ProfileBio, id)
+	if err != nil {
+		return err
+	}
+	encUserName, err := r.pii.Encrypt(name, pii.UserName, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, `
 		UPDATE profiles SET full_name = $1, bio = $2, avatar_path = $3, updated_at = $4
 		WHERE user_id=$5
-	`, name, bio, avatar_path, time.Now(), id)
+	`, encName, encBio, avatar_path, time.Now(), id)
 	if err != nil{
 		return err
 	}
-	_, err = r.db.Exec(`
-		UPDATE users SET name = $1
-		WHERE id=$2
-	`, name, id)
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE users SET name = $1, name_index = $2
+		WHERE id=$3
+	`, encUserName, r.pii.NameIndex(name), id)
 	if err != nil{
 		return err
 	}
 	return nil
 }
 
-func(r *UserRepository) GetProfile(id int) (*AboutPerson, error){
+func (r *UserRepository) GetProfile(ctx context.Context, id int) (*AboutPerson, error){
+	ctx, cancel := r.timeouts.Apply(ctx, "user.GetProfile")
+	defer cancel()
 	p := &AboutPerson{}
-	row := r.db.QueryRow(`
+	row := r.db.QueryRowContext(ctx, `
 	SELECT full_name, bio, avatar_path
 	FROM profiles
 	WHERE user_id=$1
@@ -118,11 +209,19 @@ func(r *UserRepository) GetProfile(id int) (*AboutPerson, error){
 	if err != nil{
 		return nil, err
 	}
+	err = r.pii.DecryptAll(ctx,
+		pii.Field{Column: pii.ProfileFullName, RowID: id, Value: &p.Full_name},
+		pii.Field{Column: pii.ProfileBio, RowID: id, Value: &p.Bio})
+	if err != nil {
+		return nil, err
+	}
 	return p, nil
 }
-func(r *UserRepository) GetAvatar_path(id int) (string, error){
+func (r *UserRepository) GetAvatar_path(ctx context.Context, id int) (string, error){
+	ctx, cancel := r.timeouts.Apply(ctx, "user.GetAvatar_path")
+	defer cancel()
 	var p string
-	row := r.db.QueryRow(`
+	row := r.db.QueryRowContext(ctx, `
 	SELECT avatar_path
 	FROM profiles
 	WHERE user_id=$1
@@ -131,24 +230,34 @@ func(r *UserRepository) GetAvatar_path(id int) (string, error){
 	return p, nil
 }
 
-func (r *UserRepository) GetUserByID(id int) (*User, error) {
+func (r *UserRepository) GetUserByID(ctx context.Context, id int) (*User, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.GetUserByID")
+	defer cancel()
 	u := &User{}
-	row := r.db.QueryRow(`
-		SELECT id, name, email, balance_tjs, balance_usd, balance_eur 
+	row := r.db.QueryRowContext(ctx, `
+		SELECT id, name, email, balance_tjs, balance_usd, balance_eur, role, frozen, tier, kyc_level
 		FROM users 
 		WHERE id=$1
 	`, id)
-	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.BalanceTJS, &u.BalanceUSD, &u.BalanceEUR)
+	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.BalanceTJS, &u.BalanceUSD, &u.BalanceEUR, &u.Role, &u.Frozen, &u.Tier, &u.KYCLevel)
 	if err != nil {
 		return nil, err
 	}
+	if err := r.pii.DecryptAll(ctx, userFields(u)...); err != nil {
+		return nil, err
+	}
 	return u, nil
 }
-func (r *UserRepository) GetTransactionsByID(userID int) ([]*Transactions, error) {
-	rows, err := r.db.Query(`
-		SELECT type, amount, currency, description, created_at
-		FROM transactions
-		WHERE user_id = $1
+func (r *UserRepository) GetTransactionsByID(ctx context.Context, userID int) ([]*Transactions, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.GetTransactionsByID")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+transactionColumns+`
+		FROM transactions t
+		LEFT JOIN users c ON c.id = t.counterparty_id
+		LEFT JOIN transactions l ON l.id = t.linked_id
+		WHERE t.user_id = $1
+		ORDER BY t.created_at DESC, t.id DESC
 	`, userID)
 	if err != nil {
 		return nil, err
@@ -157,8 +266,8 @@ func (r *UserRepository) GetTransactionsByID(userID int) ([]*Transactions, error
 	
 	var transactions []*Transactions
 	for rows.Next() {
-		t := &Transactions{}
-		if err := rows.Scan(&t.TType, &t.Amount, &t.Currency, &t.Description, &t.CreatedAt); err != nil {
+		t, err := r.scanTransaction(ctx, rows)
+		if err != nil {
 			return nil, err
 		}
 		transactions = append(transactions, t)
@@ -171,10 +280,71 @@ func (r *UserRepository) GetTransactionsByID(userID int) ([]*Transactions, error
 	return transactions, nil
 }
 
+// GetTransactionByReference ищет операцию пользователя по публичному номеру
+func (r *UserRepository) GetTransactionByReference(ctx context.Context, userID int, ref string) (*Transactions, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.GetTransactionByReference")
+	defer cancel()
+	t, err := r.FindTransaction(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if t.UserID != userID {
+		return nil, errors.New("transaction not found")
+	}
+	return t, nil
+}
+
+// FindTransaction ищет операцию по публичному номеру без привязки к владельцу —
+// только для проверки квитанций и админки
+func (r *UserRepository) FindTransaction(ctx context.Context, ref string) (*Transactions, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.FindTransaction")
+	defer cancel()
+	row := r.db.QueryRowContext(ctx, `
+		SELECT `+transactionColumns+`
+		FROM transactions t
+		LEFT JOIN users c ON c.id = t.counterparty_id
+		LEFT JOIN transactions l ON l.id = t.linked_id
+		WHERE t.reference = $1
+	`, ref)
+	t, err := r.scanTransaction(ctx, row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("transaction not found")
+	}
+	return t, err
+}
+
+const transactionColumns = `t.id, t.reference, t.user_id, t.type, t.amount, t.currency, t.description, t.created_at,
+	COALESCE(t.reversal_of, 0),
+	EXISTS(SELECT 1 FROM transactions r WHERE r.reversal_of IN (t.id, t.linked_id)),
+	COALESCE(t.counterparty_id, 0), COALESCE(t.linked_id, 0), COALESCE(t.refund_of, 0),
+	COALESCE((SELECT SUM(-f.amount) FROM transactions f WHERE f.refund_of = t.id AND f.user_id = t.user_id), 0),
+	COALESCE(c.name, ''), COALESCE(l.reference, ''), t.status, COALESCE(t.rate, 0), t.fee, t.payment_reference`
 
+// scanner — *sql.Row или *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
 
-func (r *UserRepository) GetAllUsersExcept(excludeID int) ([]*User, error) {
-	rows, err := r.db.Query("SELECT id, name FROM users WHERE id != $1", excludeID)
+func (r *UserRepository) scanTransaction(ctx context.Context, row scanner) (*Transactions, error) {
+	t := &Transactions{}
+	err := row.Scan(&t.ID, &t.Reference, &t.UserID, &t.TType, &t.Amount, &t.Currency, &t.Description, &t.CreatedAt,
+		&t.ReversalOf, &t.Reversed, &t.CounterpartyID, &t.LinkedID, &t.RefundOf, &t.Refunded,
+		&t.CounterpartyName, &t.LinkedReference, &t.Status, &t.Rate, &t.Fee, &t.PaymentReference)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.pii.DecryptAll(ctx, pii.Field{Column: pii.UserName, RowID: t.CounterpartyID, Value: &t.CounterpartyName}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+
+
+func (r *UserRepository) GetAllUsersExcept(ctx context.Context, excludeID int) ([]*User, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.GetAllUsersExcept")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, "SELECT id, name FROM users WHERE id != $1 AND role != 'system'", excludeID)
 	if err != nil {
 		return nil, err
 	}
@@ -186,78 +356,186 @@ func (r *UserRepository) GetAllUsersExcept(excludeID int) ([]*User, error) {
 		if err := rows.Scan(&u.ID, &u.Name); err != nil {
 			return nil, err
 		}
+		if err := r.pii.DecryptAll(ctx, pii.Field{Column: pii.UserName, RowID: u.ID, Value: &u.Name}); err != nil {
+			return nil, err
+		}
 		users = append(users, u)
 	}
 	return users, nil
 }
 
-func (r *UserRepository) Deposit(userID int, amount float64) error {
-	tx, err := r.db.Begin()
+func (r *UserRepository) Deposit(ctx context.Context, userID int, amount float64, limit limits.Limit, notices ...events.Notice) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.Deposit")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(`UPDATE users SET balance_tjs = balance_tjs + $1 WHERE id=$2`, amount, userID)
+	_, err = tx.ExecContext(ctx, `SELECT id FROM users WHERE id=$1 FOR UPDATE`, userID)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
+	if err := limits.CheckDeposit(ctx, tx, limit, userID, "TJS", amount); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-	_, err = tx.Exec(`
-		INSERT INTO transactions (user_id, type, amount, currency, description, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, userID, "deposit", amount, "TJS", "Пополнение счета", time.Now())
+	_, err = tx.ExecContext(ctx, `UPDATE users SET balance_tjs = balance_tjs + $1 WHERE id=$2`, amount, userID)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
+	entry := &Transactions{
+		UserID:      userID,
+		TType:       "deposit",
+		Amount:      amount,
+		Currency:    "TJS",
+		Description: "Пополнение счета",
+	}
+	if err := insertEntry(ctx, tx, entry); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := enqueueEvents(ctx, tx, entry); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := enqueueNotices(ctx, tx, notices...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	return tx.Commit()
 }
 
-func (r *UserRepository) Transfer(fromID, toID int, amount float64) error {
-	tx, err := r.db.Begin()
+func (r *UserRepository) Transfer(ctx context.Context, fromID, toID int, amount float64, cur string, limit limits.Limit, charge fee.Charge, opts TransferOptions, notices ...events.Notice) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.Transfer")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	var senderBalance float64
-	err = tx.QueryRow(`SELECT balance_tjs FROM users WHERE id=$1`, fromID).Scan(&senderBalance)
-	if err != nil {
+	// Под блокировкой обоих участников считаются и лимиты отправителя
+	if err := lockUsers(ctx, tx, fromID, toID); err != nil {
 		tx.Rollback()
 		return err
 	}
-	if senderBalance < amount {
+	if err := limits.CheckOutflow(ctx, tx, limit, fromID, cur, amount+charge.Amount); err != nil {
 		tx.Rollback()
-		return errors.New("insufficient funds")
+		return err
 	}
 
-	_, err = tx.Exec(`UPDATE users SET balance_tjs = balance_tjs - $1 WHERE id=$2`, amount, fromID)
-	if err != nil {
+	if err := applyBalanceChange(ctx, tx, fromID, cur, -(amount + charge.Amount)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := applyBalanceChange(ctx, tx, toID, cur, amount); err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	_, err = tx.Exec(`UPDATE users SET balance_tjs = balance_tjs + $1 WHERE id=$2`, amount, toID)
-	if err != nil {
+	sent := &Transactions{
+		UserID:           fromID,
+		TType:            "transfer",
+		Amount:           -amount,
+		Currency:         cur,
+		Description:      "Перевод пользователю " + fmt.Sprint(toID),
+		CounterpartyID:   toID,
+		Fee:              charge.Amount,
+		PaymentReference: opts.PaymentReference,
+	}
+	received := &Transactions{
+		UserID:           toID,
+		TType:            "transfer",
+		Amount:           amount,
+		Currency:         cur,
+		Description:      "Получено от пользователя " + fmt.Sprint(fromID),
+		CounterpartyID:   fromID,
+		PaymentReference: opts.PaymentReference,
+	}
+	if err := insertPair(ctx, tx, sent, received); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := enqueueEvents(ctx, tx, sent, received); err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	_, err = tx.Exec(`
-		INSERT INTO transactions (user_id, type, amount, currency, description, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, fromID, "transfer", -amount, "TJS", "Перевод пользователю "+fmt.Sprint(toID), time.Now())
-	if err != nil {
+	if err := postFee(ctx, tx, sent, charge, "Комиссия за перевод пользователю "+fmt.Sprint(toID)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := enqueueNotices(ctx, tx, notices...); err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	_, err = tx.Exec(`
-		INSERT INTO transactions (user_id, type, amount, currency, description, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, toID, "transfer", amount, "TJS", "Получено от пользователя "+fmt.Sprint(fromID), time.Now())
+	if opts.InTx != nil {
+		if err := opts.InTx(ctx, tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+
+func (r *UserRepository) ConvertCurrency(ctx context.Context, userID int, from, to string, amount, rate float64, charge fee.Charge, notices ...events.Notice) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.ConvertCurrency")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
+		return err
+	}
+
+	if err := applyBalanceChange(ctx, tx, userID, from, -(amount + charge.Amount)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	converted := amount * rate
+	if err := applyBalanceChange(ctx, tx, userID, to, converted); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	out := &Transactions{
+		UserID:      userID,
+		TType:       "conversion",
+		Amount:      -amount,
+		Currency:    from,
+		Description: "Конвертация в " + to,
+		Rate:        rate,
+		Fee:         charge.Amount,
+	}
+	in := &Transactions{
+		UserID:      userID,
+		TType:       "conversion",
+		Amount:      converted,
+		Currency:    to,
+		Description: "Конвертация из " + from,
+		Rate:        rate,
+	}
+	if err := insertPair(ctx, tx, out, in); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := enqueueEvents(ctx, tx, out, in); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := postFee(ctx, tx, out, charge, "Комиссия за конвертацию "+from+" → "+to); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := enqueueNotices(ctx, tx, notices...); err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -266,33 +544,710 @@ func (r *UserRepository) Transfer(fromID, toID int, amount float64) error {
 }
 
 
-func (r *UserRepository) ConvertCurrency(userID int, from, to string, amount, rate float64) error {
-	tx, err := r.db.Begin()
+func (r *UserRepository) SearchUsers(ctx context.Context, query string) ([]*User, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.SearchUsers")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, name, email, balance_tjs, balance_usd, balance_eur, role, frozen, tier, kyc_level
+		FROM users
+		WHERE email_index = $1 OR name_index = $2 OR id::text = $3
+		ORDER BY id
+		LIMIT 50
+	`, r.pii.BlindIndex(query), r.pii.NameIndex(query), strings.TrimSpace(query))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		u := &User{}
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.BalanceTJS, &u.BalanceUSD, &u.BalanceEUR, &u.Role, &u.Frozen, &u.Tier, &u.KYCLevel); err != nil {
+			return nil, err
+		}
+		if err := r.pii.DecryptAll(ctx, userFields(u)...); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (r *UserRepository) SetFrozen(ctx context.Context, userID int, frozen bool, notices ...events.Notice) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.SetFrozen")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(`UPDATE users SET balance_`+from+` = balance_`+from+` - $1 WHERE id=$2`, amount, userID)
+	res, err := tx.ExecContext(ctx, `UPDATE users SET frozen = $1 WHERE id=$2`, frozen, userID)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
-
-	converted := amount * rate
-	_, err = tx.Exec(`UPDATE users SET balance_`+to+` = balance_`+to+` + $1 WHERE id=$2`, converted, userID)
+	n, err := res.RowsAffected()
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
+	if n == 0 {
+		tx.Rollback()
+		return errors.New("user not found")
+	}
+	for _, notice := range notices {
+		if err := outbox.Notify(ctx, tx, notice); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ReverseTransaction проводит компенсирующие записи на суммы, обратные исходной операции.
+// Отменяются все её стороны: обе части перевода, возврата или конвертации,
+// а также списанная за неё комиссия вместе с зачислением на счёт доходов.
+func (r *UserRepository) ReverseTransaction(ctx context.Context, txID int, reason string) (*Transactions, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.ReverseTransaction")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	orig, err := lockEntry(ctx, tx, txID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if orig.ReversalOf != 0 {
+		tx.Rollback()
+		return nil, errors.New("reversal entries cannot be reversed")
+	}
+
+	legs := []*Transactions{orig}
+	switch {
+	case orig.LinkedID != 0:
+		linked, err := lockEntry(ctx, tx, orig.LinkedID)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		legs = append(legs, linked)
+	case orig.TType == "conversion":
+		// Старые конвертации записаны одной строкой без курса — зачисление не восстановить
+		tx.Rollback()
+		return nil, errors.New("this conversion cannot be reversed")
+	case orig.CounterpartyID != 0:
+		// Старые переводы без связанной записи: вторая сторона известна только по контрагенту
+		legs = append(legs, &Transactions{
+			UserID:         orig.CounterpartyID,
+			Amount:         -orig.Amount,
+			Currency:       orig.Currency,
+			CounterpartyID: orig.UserID,
+		})
+	}
+
+	ids := []int{orig.ID}
+	if orig.LinkedID != 0 {
+		ids = append(ids, orig.LinkedID)
+	}
+	var reversed, refunded bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM transactions WHERE reversal_of = ANY($1)),
+			EXISTS(SELECT 1 FROM transactions WHERE refund_of = ANY($1))
+	`, pq.Array(ids)).Scan(&reversed, &refunded)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if reversed {
+		tx.Rollback()
+		return nil, errors.New("transaction already reversed")
+	}
+	if refunded {
+		tx.Rollback()
+		return nil, errors.New("transaction has refunds and cannot be reversed")
+	}
+
+	// Комиссия за операцию отменяется вместе с ней: плательщику она возвращается,
+	// со счёта доходов списывается
+	fees, err := lockFees(ctx, tx, ids)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	reversedIDs := ids
+	for _, f := range fees {
+		reversedIDs = append(reversedIDs, f.ID)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE transactions SET status = $1 WHERE id = ANY($2)`, StatusReversed, pq.Array(reversedIDs))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var userIDs []int
+	for _, leg := range append(legs, fees...) {
+		userIDs = append(userIDs, leg.UserID)
+	}
+	if err := lockUsers(ctx, tx, userIDs...); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var entries []*Transactions
+	// Стороны операции и стороны комиссии — отдельные пары связанных записей
+	for _, group := range [][]*Transactions{legs, fees} {
+		if len(group) == 0 {
+			continue
+		}
+		pair := make([]*Transactions, len(group))
+		for i, leg := range group {
+			if err := applyBalanceChange(ctx, tx, leg.UserID, leg.Currency, -leg.Amount); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			pair[i] = &Transactions{
+				UserID:         leg.UserID,
+				TType:          "reversal",
+				Amount:         -leg.Amount,
+				Currency:       leg.Currency,
+				Description:    "Отмена операции " + orig.Reference + ": " + reason,
+				CounterpartyID: leg.CounterpartyID,
+				ReversalOf:     orig.ID,
+				Rate:           leg.Rate,
+			}
+		}
+
+		if len(pair) == 2 {
+			err = insertPair(ctx, tx, pair[0], pair[1])
+		} else {
+			err = insertEntry(ctx, tx, pair[0])
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		entries = append(entries, pair...)
+	}
+	if err := enqueueEvents(ctx, tx, entries...); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
 
-	_, err = tx.Exec(`
-		INSERT INTO transactions (user_id, type, amount, currency, description, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, userID, "conversion", amount, from, "Конвертация в "+to, time.Now())
+	notices := []events.Notice{{UserID: orig.UserID, Kind: events.KindAccount, Message: "Операция " + orig.Reference + " отменена"}}
+	if orig.CounterpartyID != 0 {
+		notices = append(notices, events.Notice{UserID: orig.CounterpartyID, Kind: events.KindAccount, Message: "Операция " + orig.Reference + " отменена"})
+	}
+	if err := enqueueNotices(ctx, tx, notices...); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return orig, tx.Commit()
+}
+
+// Refund возвращает отправителю всю сумму полученного перевода или её часть.
+// Сумма всех возвратов по одному переводу не может превысить сам перевод.
+func (r *UserRepository) Refund(ctx context.Context, userID, txID int, amount float64, reason string) (*Transactions, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.Refund")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	orig, err := lockEntry(ctx, tx, txID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if orig.UserID != userID || orig.TType != "transfer" || orig.Amount <= 0 || orig.CounterpartyID == 0 {
+		tx.Rollback()
+		return nil, errors.New("only received transfers can be refunded")
+	}
+
+	ids := []int{orig.ID}
+	if orig.LinkedID != 0 {
+		ids = append(ids, orig.LinkedID)
+	}
+	var reversed bool
+	var refunded float64
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM transactions WHERE reversal_of = ANY($1)),
+			COALESCE((SELECT SUM(-amount) FROM transactions WHERE refund_of = $2 AND user_id = $3), 0)
+	`, pq.Array(ids), orig.ID, userID).Scan(&reversed, &refunded)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if reversed {
+		tx.Rollback()
+		return nil, errors.New("transaction already reversed")
+	}
+	remaining := math.Round((orig.Amount-refunded)*100) / 100
+	if amount > remaining {
+		tx.Rollback()
+		return nil, fmt.Errorf("refund exceeds the remaining %.2f %s", remaining, orig.Currency)
+	}
+
+	if err := lockUsers(ctx, tx, userID, orig.CounterpartyID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := applyBalanceChange(ctx, tx, userID, orig.Currency, -amount); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := applyBalanceChange(ctx, tx, orig.CounterpartyID, orig.Currency, amount); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	status := StatusPartiallyRefunded
+	if amount == remaining {
+		status = StatusRefunded
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE transactions SET status = $1 WHERE id = ANY($2)`, status, pq.Array(ids))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	note := ""
+	if reason != "" {
+		note = ": " + reason
+	}
+	sent := &Transactions{
+		UserID:         userID,
+		TType:          "refund",
+		Amount:         -amount,
+		Currency:       orig.Currency,
+		Description:    "Возврат пользователю " + fmt.Sprint(orig.CounterpartyID) + " по операции " + orig.Reference + note,
+		CounterpartyID: orig.CounterpartyID,
+		RefundOf:       orig.ID,
+	}
+	received := &Transactions{
+		UserID:         orig.CounterpartyID,
+		TType:          "refund",
+		Amount:         amount,
+		Currency:       orig.Currency,
+		Description:    "Возврат от пользователя " + fmt.Sprint(userID) + note,
+		CounterpartyID: userID,
+		RefundOf:       orig.ID,
+	}
+	if err := insertPair(ctx, tx, sent, received); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := enqueueEvents(ctx, tx, sent, received); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = enqueueNotices(ctx, tx,
+		events.Notice{UserID: userID, Kind: events.KindTransferOut, Message: fmt.Sprintf("Возврат %.2f %s по операции %s выполнен", amount, orig.Currency, orig.Reference)},
+		events.Notice{UserID: orig.CounterpartyID, Kind: events.KindTransferIn, Message: fmt.Sprintf("Получен возврат %.2f %s", amount, orig.Currency)},
+	)
 	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return orig, tx.Commit()
+}
+
+// AdjustBalance вручную изменяет баланс на amount (может быть отрицательной)
+func (r *UserRepository) AdjustBalance(ctx context.Context, userID int, cur string, amount float64, reason string, notices ...events.Notice) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.AdjustBalance")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := applyBalanceChange(ctx, tx, userID, cur, amount); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	entry := &Transactions{
+		UserID:      userID,
+		TType:       "adjustment",
+		Amount:      amount,
+		Currency:    cur,
+		Description: "Корректировка: " + reason,
+	}
+	if err := insertEntry(ctx, tx, entry); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := enqueueEvents(ctx, tx, entry); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := enqueueNotices(ctx, tx, notices...); err != nil {
 		tx.Rollback()
 		return err
 	}
 
 	return tx.Commit()
 }
+
+// GrantWelcomeBonus зачисляет приветственный бонус в транзакции вызывающего tx,
+// если он ещё не выплачивался. Возвращает false, если бонус уже был.
+func (r *UserRepository) GrantWelcomeBonus(ctx context.Context, tx *sql.Tx, userID int, amount float64) (bool, error) {
+	res, err := tx.ExecContext(ctx, `UPDATE users SET welcome_bonus_paid = TRUE WHERE id = $1 AND NOT welcome_bonus_paid`, userID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	if err := applyBalanceChange(ctx, tx, userID, "TJS", amount); err != nil {
+		return false, err
+	}
+	entry := &Transactions{
+		UserID:      userID,
+		TType:       "adjustment",
+		Amount:      amount,
+		Currency:    "TJS",
+		Description: "Приветственный бонус за подтверждение личности",
+	}
+	if err := insertEntry(ctx, tx, entry); err != nil {
+		return false, err
+	}
+	// В истории бонус — корректировка, но подписчикам он приходит отдельным типом
+	if err := outbox.Insert(ctx, tx, events.TypeBonus, userID, entry.Event()); err != nil {
+		return false, err
+	}
+	err = enqueueNotices(ctx, tx, events.Notice{UserID: userID, Kind: events.KindAccount, Message: fmt.Sprintf("Зачислен приветственный бонус %.2f TJS", amount)})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// postFee списывает комиссию за операцию op записью "fee" у плательщика и зачисляет её
+// на счёт доходов. Сам баланс плательщика уменьшается вызывающим кодом вместе с суммой операции.
+func postFee(ctx context.Context, tx *sql.Tx, op *Transactions, charge fee.Charge, description string) error {
+	if charge.Amount <= 0 {
+		return nil
+	}
+	payerID, cur := op.UserID, op.Currency
+
+	if err := applyBalanceChange(ctx, tx, charge.AccountID, cur, charge.Amount); err != nil {
+		return err
+	}
+
+	paid := &Transactions{
+		UserID:         payerID,
+		TType:          "fee",
+		Amount:         -charge.Amount,
+		Currency:       cur,
+		Description:    description,
+		CounterpartyID: charge.AccountID,
+		FeeFor:         op.ID,
+	}
+	income := &Transactions{
+		UserID:         charge.AccountID,
+		TType:          "fee_income",
+		Amount:         charge.Amount,
+		Currency:       cur,
+		Description:    description + " (от пользователя " + fmt.Sprint(payerID) + ")",
+		CounterpartyID: payerID,
+		FeeFor:         op.ID,
+	}
+	if err := insertPair(ctx, tx, paid, income); err != nil {
+		return err
+	}
+	return enqueueEvents(ctx, tx, paid, income)
+}
+
+// enqueueEvents пишет события о записях в outbox той же транзакцией:
+// подписчики узнают об операции тогда и только тогда, когда она зафиксирована
+func enqueueEvents(ctx context.Context, tx *sql.Tx, entries ...*Transactions) error {
+	for _, t := range entries {
+		if err := outbox.Insert(ctx, tx, t.TType, t.UserID, t.Event()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueueNotices пишет в outbox новый баланс получателя каждого уведомления и само уведомление.
+// Баланс читается в транзакции операции, поэтому уже учитывает её.
+func enqueueNotices(ctx context.Context, tx *sql.Tx, notices ...events.Notice) error {
+	for _, n := range notices {
+		var tjs, usd, eur float64
+		err := tx.QueryRowContext(ctx, `SELECT balance_tjs, balance_usd, balance_eur FROM users WHERE id=$1`, n.UserID).Scan(&tjs, &usd, &eur)
+		if err != nil {
+			return err
+		}
+		balances := map[string]float64{"TJS": tjs, "USD": usd, "EUR": eur}
+		if err := outbox.Insert(ctx, tx, events.TypeBalance, n.UserID, balances); err != nil {
+			return err
+		}
+		if err := outbox.Notify(ctx, tx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertEntry добавляет строку в transactions, присваивает ей публичный номер и заполняет t.ID
+func insertEntry(ctx context.Context, tx *sql.Tx, t *Transactions) error {
+	ref, err := generateReference()
+	if err != nil {
+		return err
+	}
+	t.Reference = ref
+	t.CreatedAt = time.Now()
+	if t.Status == "" {
+		t.Status = StatusCompleted
+	}
+
+	var rate sql.NullFloat64
+	if t.Rate != 0 {
+		rate = sql.NullFloat64{Float64: t.Rate, Valid: true}
+	}
+
+	return tx.QueryRowContext(ctx, `
+		INSERT INTO transactions (reference, user_id, type, amount, currency, description, created_at,
+			counterparty_id, linked_id, reversal_of, refund_of, status, rate, fee, payment_reference, fee_for)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		RETURNING id
+	`, t.Reference, t.UserID, t.TType, t.Amount, t.Currency, t.Description, t.CreatedAt,
+		nullID(t.CounterpartyID), nullID(t.LinkedID), nullID(t.ReversalOf), nullID(t.RefundOf), t.Status, rate, t.Fee,
+		t.PaymentReference, nullID(t.FeeFor)).Scan(&t.ID)
+}
+
+// generateReference — публичный номер операции вида TX251019A1B2C3D4E5
+func generateReference() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("TX%s%X", time.Now().Format("060102"), b), nil
+}
+
+// insertPair добавляет две записи одной операции — по одной у каждой стороны — и связывает их
+func insertPair(ctx context.Context, tx *sql.Tx, a, b *Transactions) error {
+	if err := insertEntry(ctx, tx, a); err != nil {
+		return err
+	}
+	b.LinkedID = a.ID
+	if err := insertEntry(ctx, tx, b); err != nil {
+		return err
+	}
+	a.LinkedID = b.ID
+	a.LinkedReference, b.LinkedReference = b.Reference, a.Reference
+	_, err := tx.ExecContext(ctx, `UPDATE transactions SET linked_id = $1 WHERE id = $2`, b.ID, a.ID)
+	return err
+}
+
+// lockEntry читает операцию с блокировкой строки до конца транзакции
+func lockEntry(ctx context.Context, tx *sql.Tx, txID int) (*Transactions, error) {
+	t := &Transactions{}
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, reference, user_id, type, amount, currency, description, COALESCE(counterparty_id, 0),
+			COALESCE(linked_id, 0), COALESCE(reversal_of, 0), COALESCE(refund_of, 0), status, COALESCE(rate, 0)
+		FROM transactions WHERE id=$1 FOR UPDATE
+	`, txID).Scan(&t.ID, &t.Reference, &t.UserID, &t.TType, &t.Amount, &t.Currency, &t.Description, &t.CounterpartyID,
+		&t.LinkedID, &t.ReversalOf, &t.RefundOf, &t.Status, &t.Rate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("transaction not found")
+	}
+	return t, err
+}
+
+// lockFees блокирует ещё не отменённые записи комиссий за операции ids
+func lockFees(ctx context.Context, tx *sql.Tx, ids []int) ([]*Transactions, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id FROM transactions WHERE fee_for = ANY($1) AND status <> $2 ORDER BY id
+	`, pq.Array(ids), StatusReversed)
+	if err != nil {
+		return nil, err
+	}
+	var feeIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		feeIDs = append(feeIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	fees := make([]*Transactions, len(feeIDs))
+	for i, id := range feeIDs {
+		if fees[i], err = lockEntry(ctx, tx, id); err != nil {
+			return nil, err
+		}
+	}
+	return fees, nil
+}
+
+// lockUsers блокирует строки пользователей в порядке id, чтобы встречные операции не взаимоблокировались
+func lockUsers(ctx context.Context, tx *sql.Tx, ids ...int) error {
+	_, err := tx.ExecContext(ctx, `SELECT id FROM users WHERE id = ANY($1) ORDER BY id FOR UPDATE`, pq.Array(ids))
+	return err
+}
+
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// applyBalanceChange меняет баланс в валюте cur и не даёт ему уйти в минус
+func applyBalanceChange(ctx context.Context, tx *sql.Tx, userID int, cur string, delta float64) error {
+	if !currency.IsSupported(cur) {
+		return errors.New("unsupported currency")
+	}
+	column := "balance_" + strings.ToLower(cur)
+
+	var balance float64
+	err := tx.QueryRowContext(ctx, `SELECT `+column+` FROM users WHERE id=$1 FOR UPDATE`, userID).Scan(&balance)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("user not found")
+		}
+		return err
+	}
+	if balance+delta < 0 {
+		return errors.New("insufficient funds")
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET `+column+` = `+column+` + $1 WHERE id=$2`, delta, userID)
+	return err
+}
+
+func (r *UserRepository) SetTier(ctx context.Context, userID int, tier string) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.SetTier")
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET tier = $1 WHERE id=$2`, tier, userID)
+	return err
+}
+
+func (r *UserRepository) GetLimitUsage(ctx context.Context, userID int, cur string) (limits.Usage, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.GetLimitUsage")
+	defer cancel()
+	return limits.GetUsage(ctx, r.db, userID, cur)
+}
+
+// ReencryptPII перешифровывает текущим ключом имена, email, ФИО и «о себе» в строках,
+// где хотя бы одно поле не подходит под шаблон LIKE keep, и заполняет email_index и name_index.
+// Строки обрабатываются пачками, каждая пачка — своей транзакцией. Возвращает число строк.
+func (r *UserRepository) ReencryptPII(ctx context.Context, keep string) (int, error) {
+	const batch = 100
+	total, lastID := 0, 0
+	for {
+		n, next, err := r.reencryptBatch(ctx, keep, lastID, batch)
+		total += n
+		if err != nil || next == 0 {
+			return total, err
+		}
+		lastID = next
+	}
+}
+
+// userFields — зашифрованные поля строки users
+func userFields(u *User) []pii.Field {
+	return []pii.Field{
+		{Column: pii.UserName, RowID: u.ID, Value: &u.Name},
+		{Column: pii.UserEmail, RowID: u.ID, Value: &u.Email},
+	}
+}
+
+type piiRow struct {
+	id            int
+	name, email   string
+	hasProfile    bool
+	fullName, bio string
+}
+
+// reencryptBatch обрабатывает до limit строк с id > afterID; next — последний id или 0, если строк больше нет
+func (r *UserRepository) reencryptBatch(ctx context.Context, keep string, afterID, limit int) (n, next int, err error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "user.ReencryptPII")
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT u.id, u.name, u.email, p.user_id IS NOT NULL, COALESCE(p.full_name, ''), COALESCE(p.bio, '')
+		FROM users u
+		LEFT JOIN profiles p ON p.user_id = u.id
+		WHERE u.id > $1 AND (
+			u.name NOT LIKE $2 OR u.email NOT LIKE $2 OR u.email_index IS NULL OR u.name_index IS NULL
+			OR p.full_name NOT LIKE $2 OR p.bio NOT LIKE $2
+		)
+		ORDER BY u.id
+		LIMIT $3
+		FOR UPDATE OF u
+	`, afterID, keep, limit)
+	if err != nil {
+		return 0, 0, err
+	}
+	var list []piiRow
+	for rows.Next() {
+		var p piiRow
+		if err := rows.Scan(&p.id, &p.name, &p.email, &p.hasProfile, &p.fullName, &p.bio); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		list = append(list, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	if len(list) == 0 {
+		return 0, 0, nil
+	}
+
+	for _, p := range list {
+		fields := []pii.Field{
+			{Column: pii.UserName, RowID: p.id, Value: &p.name},
+			{Column: pii.UserEmail, RowID: p.id, Value: &p.email},
+			{Column: pii.ProfileFullName, RowID: p.id, Value: &p.fullName},
+			{Column: pii.ProfileBio, RowID: p.id, Value: &p.bio},
+		}
+		if err := r.pii.DecryptAll(ctx, fields...); err != nil {
+			return 0, 0, fmt.Errorf("user %d: %w", p.id, err)
+		}
+		name, email := p.name, p.email
+		for _, f := range fields {
+			if *f.Value, err = r.pii.Encrypt(*f.Value, f.Column, f.RowID); err != nil {
+				return 0, 0, err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE users SET name = $1, name_index = $2, email = $3, email_index = $4 WHERE id = $5`,
+			p.name, r.pii.NameIndex(name), p.email, r.pii.BlindIndex(email), p.id)
+		if err != nil {
+			return 0, 0, fmt.Errorf("user %d: %w", p.id, err)
+		}
+		if p.hasProfile {
+			_, err = tx.ExecContext(ctx, `UPDATE profiles SET full_name = $1, bio = $2 WHERE user_id = $3`,
+				p.fullName, p.bio, p.id)
+			if err != nil {
+				return 0, 0, fmt.Errorf("user %d: %w", p.id, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return len(list), list[len(list)-1].id, nil
+}
@@ -1,38 +1,69 @@
 package user
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
+	"strings"
+
+	"online_bank/internal/currency"
+	"online_bank/internal/events"
+	"online_bank/internal/fee"
+	"online_bank/internal/limits"
+	"online_bank/internal/metrics"
+	"online_bank/internal/tracing"
 )
 
 type UserService struct {
-	repo   *UserRepository
-	apiKey string
+	repo         *UserRepository
+	rates        *currency.RateCache
+	limits       limits.Policy
+	kycLimits    limits.Policy // лимиты уровня KYC, действуют вместе с лимитами тарифа
+	fees         *fee.Engine
+	feeAccountID int
+	events       *events.Bus
+	notifier     Notifier
 }
 
-func (s *UserService) GetAllUsersExcept(excludeID int) ([]*User, error) {
-	return s.repo.GetAllUsersExcept(excludeID)
+// Notifier доставляет уведомления пользователю; реализуется notification.NotificationService
+type Notifier interface {
+	Notify(ctx context.Context, userID int, kind, message string)
 }
 
+func (s *UserService) GetAllUsersExcept(ctx context.Context, excludeID int) (_ []*User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetAllUsersExcept")
+	defer tracing.End(span, &err)
+	return s.repo.GetAllUsersExcept(ctx, excludeID)
+}
+
+
+func NewUserService(repo *UserRepository, rates *currency.RateCache, policy, kycPolicy limits.Policy, fees *fee.Engine, feeAccountID int, bus *events.Bus, notifier Notifier) *UserService {
+	return &UserService{repo: repo, rates: rates, limits: policy, kycLimits: kycPolicy, fees: fees, feeAccountID: feeAccountID, events: bus, notifier: notifier}
+}
 
-func NewUserService(repo *UserRepository, apiKey string) *UserService {
-	return &UserService{repo: repo, apiKey: apiKey}
+// Subscribe подписывает на события о балансе пользователя
+func (s *UserService) Subscribe(userID int) (<-chan events.Event, func()) {
+	return s.events.Subscribe(userID)
 }
 
-func (s *UserService) Register(name, email, password string) error {
-	existing, _ := s.repo.GetByEmail(email)
+func (s *UserService) Register(ctx context.Context, name, email, password string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Register")
+	defer tracing.End(span, &err)
+	existing, _ := s.repo.GetByEmail(ctx, email)
 	if existing != nil {
 		return errors.New("user already exists")
 	}
-	return s.repo.CreateUser(name, email, password)
+	return s.repo.CreateUser(ctx, name, email, password)
 }
 
-func (s *UserService) Login(email, password string) (string, error) {
-	u, err := s.repo.GetByEmail(email)
+func (s *UserService) Login(ctx context.Context, email, password string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Login")
+	defer tracing.End(span, &err)
+	u, err := s.repo.GetByEmail(ctx, email)
 	if err != nil {
 		return "", err
 	}
@@ -41,66 +72,399 @@ func (s *UserService) Login(email, password string) (string, error) {
 	}
 
 	if !s.repo.CheckPassword(u, password) {
+		s.notifier.Notify(ctx, u.ID, events.KindSecurity, "Неудачная попытка входа в аккаунт")
 		return "", errors.New("invalid password")
 	}
 
-	token := generateToken()
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
 
-	// Сохраняем токен
-	err = s.repo.SaveToken(u.ID, token)
+	// В базе только хеш: по нему нельзя восстановить cookie
+	err = s.repo.SaveToken(ctx, u.ID, hashToken(token))
 	if err != nil {
 		return "", err
 	}
+	s.notifier.Notify(ctx, u.ID, events.KindSecurity, "Выполнен вход в аккаунт")
 
 	return token, nil
 }
 
-func (s *UserService) GetUserIDByToken(token string) (int, error) {
-	return s.repo.GetUserIDByToken(token)
+func (s *UserService) GetUserIDByToken(ctx context.Context, token string) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserIDByToken")
+	defer tracing.End(span, &err)
+	return s.repo.GetUserIDByToken(ctx, hashToken(token))
 }
-func (s *UserService) GetBalance(userID int) (*User, error) {
-	return s.repo.GetUserByID(userID)
+
+// Logout удаляет сессию, чтобы токен нельзя было использовать после выхода
+func (s *UserService) Logout(ctx context.Context, token string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Logout")
+	defer tracing.End(span, &err)
+	return s.repo.DeleteToken(ctx, hashToken(token))
 }
-func (s *UserService) GetTransactions(userID int) ([]*Transactions, error) {
-	return s.repo.GetTransactionsByID(userID)
+func (s *UserService) GetBalance(ctx context.Context, userID int) (_ *User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetBalance")
+	defer tracing.End(span, &err)
+	return s.repo.GetUserByID(ctx, userID)
 }
-func (s *UserService) UpProfile(name, bio, avatar_path string, id int) error {
-	return s.repo.UpdateProfile(name, bio, avatar_path, id)
+func (s *UserService) GetTransactions(ctx context.Context, userID int) (_ []*Transactions, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetTransactions")
+	defer tracing.End(span, &err)
+	return s.repo.GetTransactionsByID(ctx, userID)
 }
-func (s *UserService) GetProfile(id int) (*AboutPerson, error) {
-	return s.repo.GetProfile(id)
+func (s *UserService) GetTransaction(ctx context.Context, userID int, ref string) (_ *Transactions, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetTransaction")
+	defer tracing.End(span, &err)
+	return s.repo.GetTransactionByReference(ctx, userID, ref)
 }
-func (s *UserService) GetAvatar(id int) (string, error) {
-	return s.repo.GetAvatar_path(id)
+func (s *UserService) FindTransaction(ctx context.Context, ref string) (_ *Transactions, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.FindTransaction")
+	defer tracing.End(span, &err)
+	return s.repo.FindTransaction(ctx, ref)
+}
+func (s *UserService) UpProfile(ctx context.Context, name, bio, avatar_path string, id int) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpProfile")
+	defer tracing.End(span, &err)
+	return s.repo.UpdateProfile(ctx, name, bio, avatar_path, id)
+}
+func (s *UserService) GetProfile(ctx context.Context, id int) (_ *AboutPerson, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetProfile")
+	defer tracing.End(span, &err)
+	return s.repo.GetProfile(ctx, id)
+}
+func (s *UserService) GetAvatar(ctx context.Context, id int) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetAvatar")
+	defer tracing.End(span, &err)
+	return s.repo.GetAvatar_path(ctx, id)
 }
 
 
-func (s *UserService) Deposit(userID int, amount float64) error {
+func (s *UserService) Deposit(ctx context.Context, userID int, amount float64) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Deposit")
+	defer tracing.End(span, &err)
 	if amount <= 0 {
 		return errors.New("amount must be positive")
 	}
-	return s.repo.Deposit(userID, amount)
+	u, err := s.activeUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	notice := events.Notice{UserID: userID, Kind: events.KindAccount, Message: fmt.Sprintf("Счёт пополнен на %.2f TJS", amount)}
+	if err := s.repo.Deposit(ctx, userID, amount, s.limitFor(u, "TJS"), notice); err != nil {
+		return err
+	}
+	metrics.ObserveOperation(metrics.OpDeposit, "TJS", amount)
+	return nil
 }
 
-func (s *UserService) Transfer(fromID, toID int, amount float64) error {
+// TransferOptions — необязательные параметры перевода
+type TransferOptions struct {
+	// PaymentReference — назначение платежа от получателя (номер заказа из QR-кода),
+	// сохраняется в записях обеих сторон
+	PaymentReference string
+	// InTx выполняется в транзакции перевода после проводок; ошибка отменяет перевод.
+	// Так другие пакеты меняют свои строки атомарно с движением денег.
+	InTx func(ctx context.Context, tx *sql.Tx) error
+}
+
+func (s *UserService) Transfer(ctx context.Context, fromID, toID int, amount float64, cur string) error {
+	return s.TransferWith(ctx, fromID, toID, amount, cur, TransferOptions{})
+}
+
+func (s *UserService) TransferWith(ctx context.Context, fromID, toID int, amount float64, cur string, opts TransferOptions) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Transfer")
+	defer tracing.End(span, &err)
+	u, recipient, err := s.checkTransfer(ctx, fromID, toID, amount, cur)
+	if err != nil {
+		metrics.TransferFailed(failureReason(err))
+		return err
+	}
+	charge := s.charge(fee.OpTransfer, cur, cur, amount)
+	err = s.repo.Transfer(ctx, fromID, toID, amount, cur, s.limitFor(u, cur), charge, opts,
+		events.Notice{UserID: fromID, Kind: events.KindTransferOut, Message: fmt.Sprintf("Перевод %.2f %s пользователю %s выполнен", amount, cur, recipient.Name)},
+		events.Notice{UserID: toID, Kind: events.KindTransferIn, Message: fmt.Sprintf("Получен перевод %.2f %s от %s", amount, cur, u.Name)},
+	)
+	if err != nil {
+		metrics.TransferFailed(failureReason(err))
+		return err
+	}
+	metrics.ObserveOperation(metrics.OpTransfer, cur, amount)
+	return nil
+}
+
+// QuoteTransfer считает комиссию перевода, ничего не списывая
+func (s *UserService) QuoteTransfer(ctx context.Context, fromID, toID int, amount float64, cur string) (_ *Quote, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.QuoteTransfer")
+	defer tracing.End(span, &err)
+	_, recipient, err := s.checkTransfer(ctx, fromID, toID, amount, cur)
+	if err != nil {
+		return nil, err
+	}
+	charge := s.charge(fee.OpTransfer, cur, cur, amount)
+	return &Quote{
+		RecipientID:   recipient.ID,
+		RecipientName: recipient.Name,
+		Amount:        amount,
+		Currency:      cur,
+		Fee:           charge.Amount,
+		Total:         amount + charge.Amount,
+	}, nil
+}
+
+func (s *UserService) checkTransfer(ctx context.Context, fromID, toID int, amount float64, cur string) (*User, *User, error) {
 	if amount <= 0 {
-		return errors.New("amount must be positive")
+		return nil, nil, errors.New("amount must be positive")
 	}
-	return s.repo.Transfer(fromID, toID, amount)
+	if !currency.IsSupported(cur) {
+		return nil, nil, errors.New("unsupported currency")
+	}
+	if fromID == toID {
+		return nil, nil, errors.New("cannot transfer to yourself")
+	}
+	sender, err := s.activeUser(ctx, fromID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := requireKYC(sender, KYCBasic); err != nil {
+		return nil, nil, err
+	}
+	recipient, err := s.ValidateRecipient(ctx, toID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sender, recipient, nil
+}
+
+// ValidateRecipient проверяет, что на счёт toID можно переводить: он существует,
+// не заморожен и не служебный. Те же проверки выполняет каждый перевод.
+func (s *UserService) ValidateRecipient(ctx context.Context, toID int) (_ *User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.ValidateRecipient")
+	defer tracing.End(span, &err)
+	recipient, err := s.repo.GetUserByID(ctx, toID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("recipient not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if recipient.Frozen {
+		return nil, errors.New("recipient account is frozen")
+	}
+	if recipient.Role == "system" {
+		return nil, errors.New("invalid recipient")
+	}
+	return recipient, nil
 }
 
+// failureReason сводит ошибку перевода к короткому коду для метрик
+func failureReason(err error) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "insufficient funds"):
+		return "insufficient_funds"
+	case strings.Contains(msg, "limit"):
+		return "limit_exceeded"
+	case strings.Contains(msg, "frozen"):
+		return "frozen"
+	case strings.Contains(msg, "verification"):
+		return "kyc_required"
+	case strings.Contains(msg, "amount must be positive"):
+		return "invalid_amount"
+	case strings.Contains(msg, "unsupported currency"):
+		return "unsupported_currency"
+	case strings.Contains(msg, "yourself"), strings.Contains(msg, "recipient"), strings.Contains(msg, "user not found"):
+		return "invalid_recipient"
+	}
+	return "other"
+}
+
+func (s *UserService) charge(op, from, to string, amount float64) fee.Charge {
+	return fee.Charge{
+		Amount:    s.fees.Calculate(op, from, to, amount),
+		AccountID: s.feeAccountID,
+	}
+}
+
+// limitFor — лимит пользователя в валюте: более строгий из лимитов тарифа и уровня KYC
+func (s *UserService) limitFor(u *User, cur string) limits.Limit {
+	return limits.Stricter(s.limits.For(u.Tier, cur), s.kycLimits.For(u.KYCLevel, cur))
+}
 
-func (s *UserService) ConvertCurrency(userID int, from string, to string, amount float64, rate float64) error {
+// requireKYC отказывает, если личность пользователя подтверждена ниже уровня min
+func requireKYC(u *User, min string) error {
+	if !KYCAtLeast(u.KYCLevel, min) {
+		return fmt.Errorf("identity verification required: %s KYC level or higher", min)
+	}
+	return nil
+}
+
+// activeUser возвращает пользователя, если его счёт не заморожен
+func (s *UserService) activeUser(ctx context.Context, userID int) (*User, error) {
+	u, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Frozen {
+		return nil, errors.New("account is frozen")
+	}
+	return u, nil
+}
+
+// GetLimits возвращает лимиты тарифа и уровня KYC пользователя и их остаток по каждой валюте
+func (s *UserService) GetLimits(ctx context.Context, userID int) (_ []limits.Status, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetLimits")
+	defer tracing.End(span, &err)
+	u, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []limits.Status
+	for _, cur := range currency.Supported {
+		usage, err := s.repo.GetLimitUsage(ctx, userID, cur)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, limits.Status{
+			Currency: cur,
+			Limit:    s.limitFor(u, cur),
+			Usage:    usage,
+		})
+	}
+	return statuses, nil
+}
+
+func (s *UserService) SetTier(ctx context.Context, userID int, tier string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.SetTier")
+	defer tracing.End(span, &err)
+	if _, ok := s.limits[tier]; !ok {
+		return errors.New("unknown tier")
+	}
+	return s.repo.SetTier(ctx, userID, tier)
+}
+
+// GrantWelcomeBonus зачисляет приветственный бонус один раз за всё время счёта.
+// Выполняется в транзакции tx вызывающего, чтобы бонус зачислялся вместе с событием,
+// которое его даёт; true — бонус зачислен сейчас.
+func (s *UserService) GrantWelcomeBonus(ctx context.Context, tx *sql.Tx, userID int, amount float64) (_ bool, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GrantWelcomeBonus")
+	defer tracing.End(span, &err)
+	if amount <= 0 {
+		return false, nil
+	}
+	return s.repo.GrantWelcomeBonus(ctx, tx, userID, amount)
+}
+
+func (s *UserService) SearchUsers(ctx context.Context, query string) (_ []*User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.SearchUsers")
+	defer tracing.End(span, &err)
+	return s.repo.SearchUsers(ctx, query)
+}
+
+func (s *UserService) SetFrozen(ctx context.Context, userID int, frozen bool) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.SetFrozen")
+	defer tracing.End(span, &err)
+	notice := events.Notice{UserID: userID, Kind: events.KindSecurity, Message: "Счёт разморожен"}
+	if frozen {
+		notice.Message = "Счёт заморожен. Обратитесь в поддержку."
+	}
+	return s.repo.SetFrozen(ctx, userID, frozen, notice)
+}
+
+func (s *UserService) ReverseTransaction(ctx context.Context, txID int, reason string) (_ *Transactions, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.ReverseTransaction")
+	defer tracing.End(span, &err)
+	if reason == "" {
+		return nil, errors.New("reason is required")
+	}
+	return s.repo.ReverseTransaction(ctx, txID, reason)
+}
+
+// Refund возвращает отправителю полученный перевод полностью или частично
+func (s *UserService) Refund(ctx context.Context, userID, txID int, amount float64, reason string) (_ *Transactions, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Refund")
+	defer tracing.End(span, &err)
+	if amount <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+	if _, err := s.activeUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.Refund(ctx, userID, txID, amount, reason)
+}
+
+func (s *UserService) AdjustBalance(ctx context.Context, userID int, cur string, amount float64, reason string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.AdjustBalance")
+	defer tracing.End(span, &err)
+	if amount == 0 {
+		return errors.New("amount must not be zero")
+	}
+	if reason == "" {
+		return errors.New("reason is required")
+	}
+	notice := events.Notice{UserID: userID, Kind: events.KindAccount, Message: fmt.Sprintf("Корректировка баланса: %+.2f %s", amount, cur)}
+	return s.repo.AdjustBalance(ctx, userID, cur, amount, reason, notice)
+}
+
+
+func (s *UserService) ConvertCurrency(ctx context.Context, userID int, from string, to string, amount float64, rate float64) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.ConvertCurrency")
+	defer tracing.End(span, &err)
 	if amount <= 0 {
 		return errors.New("amount must be positive")
 	}
 	if rate <= 0 {
 		return errors.New("rate must be positive")
 	}
-	return s.repo.ConvertCurrency(userID, from, to, amount, rate)
+	if !currency.IsSupported(from) || !currency.IsSupported(to) {
+		return errors.New("unsupported currency")
+	}
+	u, err := s.activeUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := requireKYC(u, KYCBasic); err != nil {
+		return err
+	}
+	charge := s.charge(fee.OpConversion, from, to, amount)
+	notice := events.Notice{UserID: userID, Kind: events.KindAccount, Message: fmt.Sprintf("Конвертация %.2f %s → %s выполнена", amount, from, to)}
+	if err := s.repo.ConvertCurrency(ctx, userID, from, to, amount, rate, charge, notice); err != nil {
+		return err
+	}
+	metrics.ObserveOperation(metrics.OpConversion, from, amount)
+	return nil
+}
+
+// QuoteConversion считает курс и комиссию конвертации, ничего не списывая
+func (s *UserService) QuoteConversion(ctx context.Context, from, to string, amount float64) (_ *Quote, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.QuoteConversion")
+	defer tracing.End(span, &err)
+	if amount <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+	if !currency.IsSupported(from) || !currency.IsSupported(to) {
+		return nil, errors.New("unsupported currency")
+	}
+	rate, err := s.GetCurrencyRate(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	charge := s.charge(fee.OpConversion, from, to, amount)
+	return &Quote{
+		Amount:     amount,
+		Currency:   from,
+		Fee:        charge.Amount,
+		Total:      amount + charge.Amount,
+		ToCurrency: to,
+		Rate:       rate,
+		Converted:  amount * rate,
+	}, nil
 }
 
-func (s *UserService) GetCurrencyRate(from, to string) (float64, error) {
+func (s *UserService) GetCurrencyRate(ctx context.Context, from, to string) (_ float64, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetCurrencyRate")
+	defer tracing.End(span, &err)
 
     if from == to {
         return 1.0, nil
@@ -111,14 +475,14 @@ func (s *UserService) GetCurrencyRate(from, to string) (float64, error) {
     const usdToTjs = 1 / tjsToUsd
 
     if from == "TJS" && to != "TJS" {
-        usdRate, err := s.getRateFromAPI("USD", to)
+        usdRate, err := s.getRateFromAPI(ctx, "USD", to)
         if err != nil {
             return 0, err
         }
         return tjsToUsd * usdRate, nil
     }
     if from != "TJS" && to == "TJS" {
-        usdRate, err := s.getRateFromAPI(from, "USD")
+        usdRate, err := s.getRateFromAPI(ctx, from, "USD")
         if err != nil {
             return 0, err
         }
@@ -129,41 +493,24 @@ func (s *UserService) GetCurrencyRate(from, to string) (float64, error) {
         return 1.0, nil
     }
 
-    return s.getRateFromAPI(from, to)
+    return s.getRateFromAPI(ctx, from, to)
 }
 
 
-func (s *UserService) getRateFromAPI(from, to string) (float64, error) {
-    if s.apiKey == "" {
-        return 0, fmt.Errorf("open exchange rates API key not set")
-    }
-
-    url := fmt.Sprintf("https://openexchangerates.org/api/latest.json?app_id=%s&symbols=%s,%s", s.apiKey, from, to)
-    resp, err := http.Get(url)
-    if err != nil {
-        return 0, err
-    }
-    defer resp.Body.Close()
-
-    var data struct {
-        Rates map[string]float64 `json:"rates"`
-    }
-    if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-        return 0, err
-    }
-
-    rateFrom, ok1 := data.Rates[from]
-    rateTo, ok2 := data.Rates[to]
-    if !ok1 || !ok2 {
-        return 0, fmt.Errorf("currency not found in API response")
-    }
-
-    return rateTo / rateFrom, nil
+func (s *UserService) getRateFromAPI(ctx context.Context, from, to string) (float64, error) {
+    return s.rates.Rate(ctx, from, to)
 }
 
 
-func generateToken() string {
+func generateToken() (string, error) {
 	b := make([]byte, 32)
-	rand.Read(b)
-	return hex.EncodeToString(b)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate session token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
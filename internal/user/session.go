@@ -0,0 +1,88 @@
+package user
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// sessionCookie — cookie с токеном входа
+const sessionCookie = "auth_token"
+
+var errBadCookie = errors.New("invalid session cookie")
+
+// SessionConfig — параметры cookie входа из config.json:
+//
+//	"session": {"same_site": "strict", "signing_keys": ["новый ключ", "старый ключ"]}
+type SessionConfig struct {
+	// InsecureCookie снимает флаг Secure — только для разработки по http:// не на localhost
+	InsecureCookie bool `json:"insecure_cookie"`
+	// SameSite — "lax" (по умолчанию) или "strict"
+	SameSite string `json:"same_site"`
+	// SigningKeys — ключи HMAC для подписи cookie. Первым подписываются новые cookie,
+	// остальные только проверяются: так ключ меняют, не выкидывая пользователей.
+	// Пустой список — cookie без подписи.
+	SigningKeys []string `json:"signing_keys"`
+}
+
+// cookie возвращает cookie входа с токеном token; пустой token удаляет cookie
+func (c SessionConfig) cookie(token string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     sessionCookie,
+		Value:    c.sign(token),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   !c.InsecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if strings.EqualFold(c.SameSite, "strict") {
+		cookie.SameSite = http.SameSiteStrictMode
+	}
+	if token == "" {
+		cookie.Value = ""
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// token достаёт токен из cookie запроса и проверяет подпись
+func (c SessionConfig) token(r *http.Request) (string, error) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", err
+	}
+	if len(c.SigningKeys) == 0 {
+		return cookie.Value, nil
+	}
+
+	token, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return "", errBadCookie
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return "", errBadCookie
+	}
+	for _, key := range c.SigningKeys {
+		if hmac.Equal(mac, signature(key, token)) {
+			return token, nil
+		}
+	}
+	return "", errBadCookie
+}
+
+func (c SessionConfig) sign(token string) string {
+	if len(c.SigningKeys) == 0 || token == "" {
+		return token
+	}
+	return token + "." + base64.RawURLEncoding.EncodeToString(signature(c.SigningKeys[0], token))
+}
+
+func signature(key, token string) []byte {
+	m := hmac.New(sha256.New, []byte(key))
+	m.Write([]byte(token))
+	return m.Sum(nil)
+}
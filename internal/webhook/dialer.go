@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// errPrivateAddress — адрес вебхука ведёт во внутреннюю сеть банка
+var errPrivateAddress = errors.New("webhook URL must not point to a private, loopback or link-local address")
+
+// sharedAddressSpace — 100.64.0.0/10 (CGNAT), внутренний адрес провайдера
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP — можно ли отправлять вебхук на этот адрес
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || sharedAddressSpace.Contains(ip))
+}
+
+// checkHost проверяет при регистрации, что имя вебхука указывает только на публичные адреса
+func checkHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return errors.New("webhook host cannot be resolved")
+	}
+	for _, a := range addrs {
+		if !isPublicIP(a.IP) {
+			return errPrivateAddress
+		}
+	}
+	return nil
+}
+
+// newClient — HTTP-клиент для доставки. Адрес проверяется при каждом соединении уже после
+// разрешения имени, поэтому DNS, сменивший ответ после регистрации, не откроет внутреннюю сеть.
+// Редиректы не выполняются: ответ 3xx считается неудачной попыткой.
+func newClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Через прокси соединение шло бы к прокси, и проверка адреса потеряла бы смысл
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,167 @@
+package webhook
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"online_bank/internal/audit"
+	"online_bank/internal/user"
+)
+
+// WebhookHandler обслуживает вебхуки пользователя или, если system == true,
+// общесистемные вебхуки в админке
+type WebhookHandler struct {
+	service   *WebhookService
+	audit     *audit.AuditService
+	templates *template.Template
+	system    bool
+}
+
+func NewWebhookHandler(service *WebhookService, audit *audit.AuditService, templates *template.Template, system bool) *WebhookHandler {
+	return &WebhookHandler{service: service, audit: audit, templates: templates, system: system}
+}
+
+func (h *WebhookHandler) owner(r *http.Request) int {
+	if h.system {
+		return 0
+	}
+	return user.CurrentUser(r.Context()).ID
+}
+
+func (h *WebhookHandler) base() string {
+	if h.system {
+		return "/admin/webhooks"
+	}
+	return "/webhooks"
+}
+
+func (h *WebhookHandler) ListPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		hook, err := h.service.Create(r.Context(), h.owner(r), r.FormValue("url"), r.Form["events"])
+		h.record(r, "webhook.create", hook, err)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, h.base(), http.StatusSeeOther)
+		return
+	}
+
+	hooks, err := h.service.List(r.Context(), h.owner(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.templates.ExecuteTemplate(w, "webhooks.html", map[string]interface{}{
+		"Base":       h.base(),
+		"System":     h.system,
+		"Webhooks":   hooks,
+		"EventTypes": EventTypes,
+	})
+}
+
+func (h *WebhookHandler) DisablePage(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.postID(w, r, "id")
+	if !ok {
+		return
+	}
+	hook, _ := h.service.Get(r.Context(), id, h.owner(r))
+	err := h.service.Disable(r.Context(), id, h.owner(r))
+	h.record(r, "webhook.disable", hook, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, h.base(), http.StatusSeeOther)
+}
+
+func (h *WebhookHandler) PingPage(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.postID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.service.Ping(r.Context(), id, h.owner(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, h.base()+"/deliveries?id="+strconv.Itoa(id), http.StatusSeeOther)
+}
+
+// DeliveriesPage — журнал доставок; status=dead показывает только недоставленные
+func (h *WebhookHandler) DeliveriesPage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	hook, err := h.service.Get(r.Context(), id, h.owner(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	status := ""
+	if r.FormValue("status") == StatusDead {
+		status = StatusDead
+	}
+	deliveries, err := h.service.Deliveries(r.Context(), id, h.owner(r), status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.templates.ExecuteTemplate(w, "webhook_deliveries.html", map[string]interface{}{
+		"Base":       h.base(),
+		"Webhook":    hook,
+		"Deliveries": deliveries,
+		"Status":     status,
+	})
+}
+
+// RetryPage возвращает доставку из списка недоставленных в очередь
+func (h *WebhookHandler) RetryPage(w http.ResponseWriter, r *http.Request) {
+	deliveryID, ok := h.postID(w, r, "id")
+	if !ok {
+		return
+	}
+	webhookID, ok := h.postID(w, r, "webhook")
+	if !ok {
+		return
+	}
+	if err := h.service.Retry(r.Context(), deliveryID, webhookID, h.owner(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, h.base()+"/deliveries?id="+strconv.Itoa(webhookID), http.StatusSeeOther)
+}
+
+func (h *WebhookHandler) postID(w http.ResponseWriter, r *http.Request, field string) (int, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return 0, false
+	}
+	id, err := strconv.Atoi(r.FormValue(field))
+	if err != nil {
+		http.Error(w, "invalid "+field+" ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// record пишет изменение вебхука в журнал аудита — без секрета подписи
+func (h *WebhookHandler) record(r *http.Request, action string, hook *Webhook, opErr error) {
+	var targetID int
+	after := map[string]interface{}{"system": h.system, "url": r.FormValue("url")}
+	if hook != nil {
+		targetID = hook.ID
+		after = map[string]interface{}{"system": h.system, "url": hook.URL, "events": hook.Events}
+	}
+
+	err := h.audit.Record(r.Context(), audit.ActorFromRequest(r, user.CurrentUser(r.Context()).ID), action, "webhook", targetID, nil, after, opErr)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "не удалось записать в журнал аудита", "action", action, "err", err)
+	}
+}
@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"time"
+
+	"online_bank/internal/events"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// EventTypes — события, на которые можно подписать вебхук
+var EventTypes = []string{events.TypeDeposit, events.TypeTransfer, events.TypeConversion, events.TypeReversal,
+	events.TypeRefund, events.TypeAdjustment, events.TypeBonus, events.TypeFee, events.TypeFeeIncome}
+
+// TypePing — тестовое событие, которое отправляется кнопкой «Проверить»
+const TypePing = "ping"
+
+// Webhook — адрес, куда отправляются события. UserID == 0 — общесистемный вебхук.
+type Webhook struct {
+	ID        int
+	UserID    int
+	URL       string
+	Secret    string
+	Events    []string
+	Active    bool
+	CreatedAt time.Time
+}
+
+// Wants — подписан ли вебхук на событие; пустой список — на все
+func (w *Webhook) Wants(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type Delivery struct {
+	ID            int
+	WebhookID     int
+	EventID       string
+	EventType     string
+	Payload       string
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+	DeliveredAt   *time.Time
+	History       []*Attempt
+
+	// URL и Secret заполняются только при выборке очереди для отправки
+	URL    string
+	Secret string
+}
+
+type Attempt struct {
+	StatusCode  int
+	Error       string
+	Duration    time.Duration
+	AttemptedAt time.Time
+}
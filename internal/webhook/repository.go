@@ -0,0 +1,294 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"online_bank/internal/timeouts"
+
+	"github.com/lib/pq"
+)
+
+type WebhookRepository struct {
+	db       *sql.DB
+	timeouts timeouts.Config
+}
+
+func NewWebhookRepository(db *sql.DB, t timeouts.Config) *WebhookRepository {
+	return &WebhookRepository{db: db, timeouts: t}
+}
+
+// owner — user_id вебхука; 0 превращается в NULL (общесистемный)
+func owner(userID int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(userID), Valid: userID != 0}
+}
+
+func (r *WebhookRepository) Create(ctx context.Context, w *Webhook) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "webhook.Create")
+	defer cancel()
+	w.Active = true
+	w.CreatedAt = time.Now()
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO webhooks (user_id, url, secret, events, active, created_at)
+		VALUES ($1, $2, $3, $4, TRUE, $5)
+		RETURNING id
+	`, owner(w.UserID), w.URL, w.Secret, pq.Array(w.Events), w.CreatedAt).Scan(&w.ID)
+}
+
+const webhookColumns = `id, COALESCE(user_id, 0), url, secret, events, active, created_at`
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (*Webhook, error) {
+	w := &Webhook{}
+	err := row.Scan(&w.ID, &w.UserID, &w.URL, &w.Secret, pq.Array(&w.Events), &w.Active, &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// List возвращает активные вебхуки владельца
+func (r *WebhookRepository) List(ctx context.Context, userID int) ([]*Webhook, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "webhook.List")
+	defer cancel()
+	return r.query(ctx, `
+		SELECT `+webhookColumns+` FROM webhooks
+		WHERE user_id IS NOT DISTINCT FROM $1 AND active
+		ORDER BY created_at DESC
+	`, owner(userID))
+}
+
+// Subscribers возвращает вебхуки, которым положены события пользователя:
+// его собственные и общесистемные
+func (r *WebhookRepository) Subscribers(ctx context.Context, userID int) ([]*Webhook, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "webhook.Subscribers")
+	defer cancel()
+	return r.query(ctx, `
+		SELECT `+webhookColumns+` FROM webhooks
+		WHERE (user_id = $1 OR user_id IS NULL) AND active
+	`, userID)
+}
+
+func (r *WebhookRepository) query(ctx context.Context, q string, args ...interface{}) ([]*Webhook, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "webhook.query")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, w)
+	}
+	return list, rows.Err()
+}
+
+func (r *WebhookRepository) Get(ctx context.Context, id, userID int) (*Webhook, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "webhook.Get")
+	defer cancel()
+	w, err := scanWebhook(r.db.QueryRowContext(ctx, `
+		SELECT `+webhookColumns+` FROM webhooks
+		WHERE id = $1 AND user_id IS NOT DISTINCT FROM $2 AND active
+	`, id, owner(userID)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("webhook not found")
+	}
+	return w, err
+}
+
+// Disable выключает вебхук; журнал доставок остаётся
+func (r *WebhookRepository) Disable(ctx context.Context, id, userID int) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "webhook.Disable")
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE webhooks SET active = FALSE
+		WHERE id = $1 AND user_id IS NOT DISTINCT FROM $2 AND active
+	`, id, owner(userID))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("webhook not found")
+	}
+	return nil
+}
+
+func (r *WebhookRepository) Enqueue(ctx context.Context, d *Delivery) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "webhook.Enqueue")
+	defer cancel()
+	d.Status = StatusPending
+	d.CreatedAt = time.Now()
+	d.NextAttemptAt = d.CreatedAt
+	// Событие, уже стоящее в очереди этого вебхука, пропускается
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT (webhook_id, event_id) DO NOTHING
+	`, d.WebhookID, d.EventID, d.EventType, d.Payload, d.Status, d.CreatedAt)
+	return err
+}
+
+// Claim забирает из очереди до limit доставок, время которых наступило, и откладывает
+// их на lease — чтобы несколько экземпляров не отправили одно событие одновременно.
+// Если процесс упадёт во время отправки, доставка вернётся в очередь по истечении lease.
+func (r *WebhookRepository) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Delivery, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "webhook.Claim")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE webhook_deliveries d SET next_attempt_at = $2
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $3 AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.attempts, w.url, w.secret, w.active
+	`, now, now.Add(lease), StatusPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*Delivery
+	for rows.Next() {
+		d := &Delivery{Status: StatusPending}
+		var active bool
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Attempts, &d.URL, &d.Secret, &active); err != nil {
+			return nil, err
+		}
+		if !active {
+			// Выключенный вебхук: событие больше никуда не отправляется
+			d.Status = StatusDead
+			d.LastError = "webhook disabled"
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+// SaveAttempt записывает попытку в журнал и новое состояние доставки
+func (r *WebhookRepository) SaveAttempt(ctx context.Context, d *Delivery, a *Attempt) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "webhook.SaveAttempt")
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if a != nil {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO webhook_attempts (delivery_id, status_code, error, duration_ms, attempted_at)
+			VALUES ($1, $2, $3, $4, $5)
+		`, d.ID, a.StatusCode, a.Error, a.Duration.Milliseconds(), a.AttemptedAt)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4, delivered_at = $5
+		WHERE id = $6
+	`, d.Status, d.Attempts, d.NextAttemptAt, d.LastError, d.DeliveredAt, d.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Deliveries возвращает последние доставки вебхука вместе с попытками;
+// status == "" — в любом статусе
+func (r *WebhookRepository) Deliveries(ctx context.Context, webhookID int, status string, limit int) ([]*Delivery, error) {
+	ctx, cancel := r.timeouts.Apply(ctx, "webhook.Deliveries")
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+			last_error, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`, webhookID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*Delivery
+	byID := map[int]*Delivery{}
+	var ids []int64
+	for rows.Next() {
+		d := &Delivery{}
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+		byID[d.ID] = d
+		ids = append(ids, int64(d.ID))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	attempts, err := r.db.QueryContext(ctx, `
+		SELECT delivery_id, status_code, error, duration_ms, attempted_at
+		FROM webhook_attempts
+		WHERE delivery_id = ANY($1)
+		ORDER BY attempted_at, id
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer attempts.Close()
+
+	for attempts.Next() {
+		a := &Attempt{}
+		var deliveryID int
+		var ms int64
+		if err := attempts.Scan(&deliveryID, &a.StatusCode, &a.Error, &ms, &a.AttemptedAt); err != nil {
+			return nil, err
+		}
+		a.Duration = time.Duration(ms) * time.Millisecond
+		byID[deliveryID].History = append(byID[deliveryID].History, a)
+	}
+	return list, attempts.Err()
+}
+
+// Retry возвращает доставку из списка недоставленных в очередь
+func (r *WebhookRepository) Retry(ctx context.Context, deliveryID, webhookID int) error {
+	ctx, cancel := r.timeouts.Apply(ctx, "webhook.Retry")
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = $2
+		WHERE id = $3 AND webhook_id = $4 AND status = $5
+	`, StatusPending, time.Now(), deliveryID, webhookID, StatusDead)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("delivery not found in dead letters")
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"online_bank/internal/events"
+	"online_bank/internal/logging"
+)
+
+const (
+	// maxAttempts — после стольких неудач доставка уходит в список недоставленных
+	maxAttempts = 8
+	// Пауза между попытками удваивается: 30с, 1м, 2м … но не больше maxBackoff
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+	claimLease  = 5 * time.Minute
+)
+
+// Payload — тело запроса, которое получает вебхук
+type Payload struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+type WebhookService struct {
+	repo   *WebhookRepository
+	client *http.Client
+	// allowPrivate разрешает адреса внутренней сети — только для локальной проверки
+	allowPrivate bool
+}
+
+func NewWebhookService(repo *WebhookRepository, allowPrivate bool) *WebhookService {
+	return &WebhookService{repo: repo, client: newClient(allowPrivate), allowPrivate: allowPrivate}
+}
+
+// Publish ставит событие в очередь всем подходящим вебхукам; получатель событий из outbox.
+// Повторно пришедшее событие в очередь не попадает.
+func (s *WebhookService) Publish(ctx context.Context, e events.Event) error {
+	if !isEventType(e.Type) {
+		return nil
+	}
+
+	hooks, err := s.repo.Subscribers(ctx, e.UserID)
+	if err != nil {
+		return err
+	}
+	for _, w := range hooks {
+		if !w.Wants(e.Type) {
+			continue
+		}
+		if err := s.enqueue(ctx, w.ID, Payload{ID: e.ID, Type: e.Type, CreatedAt: e.At, Data: e.Data}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *WebhookService) enqueue(ctx context.Context, webhookID int, p Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return s.repo.Enqueue(ctx, &Delivery{
+		WebhookID: webhookID,
+		EventID:   p.ID,
+		EventType: p.Type,
+		Payload:   string(body),
+	})
+}
+
+// Create регистрирует вебхук. userID == 0 — общесистемный.
+func (s *WebhookService) Create(ctx context.Context, userID int, rawURL string, eventTypes []string) (*Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("webhook URL must be an absolute http(s) URL")
+	}
+	if !s.allowPrivate {
+		if err := checkHost(ctx, u.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range eventTypes {
+		if !isEventType(t) {
+			return nil, fmt.Errorf("unknown event type %q", t)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	w := &Webhook{
+		UserID: userID,
+		URL:    u.String(),
+		Secret: hex.EncodeToString(secret),
+		Events: eventTypes,
+	}
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+	if err := s.repo.Create(ctx, w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (s *WebhookService) List(ctx context.Context, userID int) ([]*Webhook, error) {
+	return s.repo.List(ctx, userID)
+}
+
+func (s *WebhookService) Get(ctx context.Context, id, userID int) (*Webhook, error) {
+	return s.repo.Get(ctx, id, userID)
+}
+
+func (s *WebhookService) Disable(ctx context.Context, id, userID int) error {
+	return s.repo.Disable(ctx, id, userID)
+}
+
+// Ping ставит в очередь тестовое событие, чтобы проверить адрес и подпись
+func (s *WebhookService) Ping(ctx context.Context, id, userID int) error {
+	w, err := s.repo.Get(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	return s.enqueue(ctx, w.ID, Payload{ID: newEventID(), Type: TypePing, CreatedAt: time.Now()})
+}
+
+// Deliveries — журнал доставок вебхука; status == StatusDead — только недоставленные
+func (s *WebhookService) Deliveries(ctx context.Context, id, userID int, status string) ([]*Delivery, error) {
+	if _, err := s.repo.Get(ctx, id, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.Deliveries(ctx, id, status, 100)
+}
+
+func (s *WebhookService) Retry(ctx context.Context, deliveryID, webhookID, userID int) error {
+	if _, err := s.repo.Get(ctx, webhookID, userID); err != nil {
+		return err
+	}
+	return s.repo.Retry(ctx, deliveryID, webhookID)
+}
+
+// RunWorker раз в interval отправляет наступившие доставки, пока не отменён ctx
+func (s *WebhookService) RunWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Начатые доставки не обрываются при остановке: их время ограничено таймаутом клиента
+		s.deliverDue(logging.WithRequestID(context.WithoutCancel(ctx), logging.NewID()), time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *WebhookService) deliverDue(ctx context.Context, now time.Time) {
+	due, err := s.repo.Claim(ctx, now, claimLease, 100)
+	if err != nil {
+		slog.ErrorContext(ctx, "не удалось получить очередь вебхуков", "err", err)
+		return
+	}
+
+	for _, d := range due {
+		var a *Attempt
+		if d.Status == StatusPending {
+			a = s.deliver(ctx, d)
+		}
+		if err := s.repo.SaveAttempt(ctx, d, a); err != nil {
+			slog.ErrorContext(ctx, "не удалось сохранить доставку вебхука", "delivery_id", d.ID, "err", err)
+		}
+	}
+}
+
+// deliver делает одну попытку и переводит доставку в следующее состояние
+func (s *WebhookService) deliver(ctx context.Context, d *Delivery) *Attempt {
+	a := &Attempt{AttemptedAt: time.Now()}
+	a.StatusCode, a.Error = s.post(ctx, d)
+	a.Duration = time.Since(a.AttemptedAt)
+
+	d.Attempts++
+	if a.Error == "" {
+		d.Status = StatusDelivered
+		d.LastError = ""
+		d.DeliveredAt = &a.AttemptedAt
+		return a
+	}
+
+	d.LastError = a.Error
+	if d.Attempts >= maxAttempts {
+		d.Status = StatusDead
+	} else {
+		d.NextAttemptAt = time.Now().Add(backoff(d.Attempts))
+	}
+	return a
+}
+
+func (s *WebhookService) post(ctx context.Context, d *Delivery) (int, string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewBufferString(d.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", d.EventID)
+	req.Header.Set("X-Webhook-Event", d.EventType)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", Sign(d.Secret, timestamp, []byte(d.Payload)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, "unexpected status " + resp.Status
+	}
+	return resp.StatusCode, ""
+}
+
+// Sign — подпись запроса: "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)).
+// Получатель пересчитывает её своим секретом и отклоняет старые timestamp,
+// чтобы перехваченный запрос нельзя было повторить.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func backoff(attempts int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+func isEventType(t string) bool {
+	for _, e := range EventTypes {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -1,51 +1,339 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"online_bank/config"
 	"online_bank/db"
+	"online_bank/internal/admin"
+	"online_bank/internal/api"
+	"online_bank/internal/apikey"
+	"online_bank/internal/audit"
+	"online_bank/internal/currency"
+	"online_bank/internal/events"
+	"online_bank/internal/fee"
+	"online_bank/internal/health"
+	"online_bank/internal/kyc"
+	"online_bank/internal/logging"
+	"online_bank/internal/mailer"
+	"online_bank/internal/metrics"
+	"online_bank/internal/notification"
+	"online_bank/internal/outbox"
+	"online_bank/internal/payrequest"
+	"online_bank/internal/pii"
+	"online_bank/internal/qrpay"
+	"online_bank/internal/ratelimit"
+	"online_bank/internal/receipt"
+	"online_bank/internal/schedule"
+	"online_bank/internal/security"
+	"online_bank/internal/static"
+	"online_bank/internal/tracing"
 	"online_bank/internal/user"
+	"online_bank/internal/webhook"
 )
 
 func main() {
 	// Загружаем конфиг
 	cfg, err := config.LoadConfig("config.json")
 	if err != nil {
-		log.Fatal(err)
+		fatal("не удалось прочитать config.json", err)
+	}
+	slog.SetDefault(logging.New(cfg.Log))
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("не удалось настроить трассировку", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	if cfg.PaymentCodeSecret == "" {
+		fatal("в config.json не задан payment_code_secret", nil)
+	}
+	if cfg.PublicURL == "" {
+		fatal("в config.json не задан public_url", nil)
+	}
+	if cfg.ReceiptSecret == "" {
+		fatal("в config.json не задан receipt_secret", nil)
 	}
 
 	// Подключаемся к БД через конфиг
 	database, err := db.Connect(cfg)
 	if err != nil {
-		log.Fatal(err)
+		fatal("не удалось подключиться к БД", err)
 	}
 	defer database.Close()
 
+	if err := db.Migrate(database); err != nil {
+		fatal("не удалось применить миграции", err)
+	}
+	metrics.RegisterDB(database)
+
+	// Персональные данные шифруются ключами из pii-keys.json или KMS
+	keys, err := pii.NewProvider(cfg.PII)
+	if err != nil {
+		fatal("не удалось загрузить ключи шифрования (создайте их: go run ./cmd/pii-rotate -new-key)", err)
+	}
+	cipher, err := pii.New(context.Background(), keys, cfg.PII.IndexKey)
+	if err != nil {
+		fatal("не удалось настроить шифрование персональных данных", err)
+	}
+
 	// Репозиторий и сервис
-	userRepo := user.NewUserRepository(database)
-	userService := user.NewUserService(userRepo, "3b294c6ae8ae4dc1bebe1e3b50fbd216")
+	userRepo := user.NewUserRepository(database, cfg.DBTimeouts, cipher)
+	// Строки, записанные до включения шифрования, шифруются до первого запроса
+	if n, err := userRepo.ReencryptPII(context.Background(), pii.EncryptedPattern()); err != nil {
+		fatal("не удалось зашифровать персональные данные", err)
+	} else if n > 0 {
+		slog.Info("персональные данные зашифрованы", "users", n)
+	}
+	feeAccount, err := userRepo.GetByEmail(context.Background(), fee.RevenueAccountEmail)
+	if err != nil || feeAccount == nil {
+		fatal("не найден счёт доходов от комиссий", err)
+	}
+	bus := events.NewBus()
+	notificationService := notification.NewNotificationService(notification.NewNotificationRepository(database, cfg.DBTimeouts), mailer.New(cfg.SMTP), userRepo, bus)
+	rates := currency.NewRateCache("3b294c6ae8ae4dc1bebe1e3b50fbd216", 3*ratesRefresh(cfg))
+	userService := user.NewUserService(userRepo, rates, cfg.Limits, cfg.KYC.LimitPolicy(), fee.NewEngine(cfg.Fees), feeAccount.ID, bus, notificationService)
+	auditService := audit.NewAuditService(audit.NewAuditRepository(database, cfg.DBTimeouts))
+	adminService := admin.NewAdminService(userService, auditService)
+	payRequestService := payrequest.NewPaymentRequestService(payrequest.NewPaymentRequestRepository(database, cfg.DBTimeouts, cipher), userService)
+	kycService := kyc.NewKYCService(kyc.NewKYCRepository(database, cfg.DBTimeouts, cipher), cfg.KYC, userService, notificationService)
+	// Документы, загруженные в раздаваемый uploads/kyc, переносятся до первого запроса
+	if n, err := kycService.MoveLegacyDocuments(context.Background()); err != nil {
+		fatal("не удалось перенести документы KYC", err)
+	} else if n > 0 {
+		slog.Info("документы KYC перенесены из uploads", "documents", n)
+	}
+	scheduleService := schedule.NewScheduleService(schedule.NewScheduleRepository(database, cfg.DBTimeouts, cipher), userService, notificationService)
+
+	webhookService := webhook.NewWebhookService(webhook.NewWebhookRepository(database, cfg.DBTimeouts), cfg.WebhookAllowPrivate)
+	// События об операциях пишутся в outbox вместе с операцией, реле раздаёт их получателям.
+	// Сюда же подключаются outbox.NATSSink и outbox.KafkaSink.
+	relay := outbox.NewRelay(outbox.NewOutboxRepository(database, cfg.DBTimeouts), outbox.BusSink{Bus: bus}, notificationService, webhookService)
+
+	// ctx отменяется по SIGINT/SIGTERM: фоновые задачи заканчивают текущий проход и выходят
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Фоновые задачи: курсы валют, запланированные переводы, outbox и доставка вебхуков
+	go rates.Run(ctx, ratesRefresh(cfg))
+	go scheduleService.RunWorker(ctx, time.Minute)
+	go relay.Run(ctx, time.Second)
+	go webhookService.RunWorker(ctx, 10*time.Second)
+
+	checker := health.NewChecker()
+	checker.Add("database", database.PingContext)
+	checker.Add("migrations", func(ctx context.Context) error {
+		pending, err := db.Pending(ctx, database)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("pending migrations: %s", strings.Join(pending, ", "))
+		}
+		return nil
+	})
+	checker.Add("rates", func(context.Context) error { return rates.Check() })
 
 	// Шаблоны
 	templates := template.Must(template.ParseGlob("templates/*.html"))
 	http.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("uploads"))))
+	http.Handle(static.Prefix, static.Handler())
 
 	// Handler
-	userHandler := user.NewUserHandler(userService, templates)
+	userHandler := user.NewUserHandler(userService, auditService, templates, cfg.Session)
+	adminHandler := admin.NewAdminHandler(adminService, templates)
+	scheduleHandler := schedule.NewScheduleHandler(scheduleService, userService, templates)
+	payRequestHandler := payrequest.NewPaymentRequestHandler(payRequestService, userService, auditService, templates)
+	qrHandler := qrpay.NewQRHandler(qrpay.NewSigner([]byte(cfg.PaymentCodeSecret)), cfg.PublicURL, userService, auditService, templates)
+	notificationHandler := notification.NewNotificationHandler(notificationService, templates)
+	webhookHandler := webhook.NewWebhookHandler(webhookService, auditService, templates, false)
+	systemWebhookHandler := webhook.NewWebhookHandler(webhookService, auditService, templates, true)
+	apiKeyService := apikey.NewAPIKeyService(apikey.NewAPIKeyRepository(database, cfg.DBTimeouts))
+	apiKeyHandler := apikey.NewAPIKeyHandler(apiKeyService, auditService, templates)
+	apiAuth := apikey.NewMiddleware(apiKeyService, userService)
+	apiHandler := api.NewAPIHandler(userService, auditService)
+	kycHandler := kyc.NewKYCHandler(kycService, auditService, templates)
+	receiptHandler := receipt.NewReceiptHandler(receipt.NewSigner([]byte(cfg.ReceiptSecret)), userService, templates)
+
+	userHandler.AddDashboardSection("requests", func(ctx context.Context, userID int) (interface{}, error) {
+		return payRequestService.Pending(ctx, userID)
+	})
+	userHandler.AddDashboardSection("notifications", func(ctx context.Context, userID int) (interface{}, error) {
+		return notificationService.Summary(ctx, userID)
+	})
 
 	// Роуты
 	http.HandleFunc("/register", userHandler.RegisterPage)
 	http.HandleFunc("/login", userHandler.LoginPage)
 	http.HandleFunc("/dashboard", userHandler.DashboardPage)
 	http.HandleFunc("/deposit", userHandler.DepositPage)
-	http.HandleFunc("/transfer", userHandler.TransferPage)
-	http.HandleFunc("/convert", userHandler.ConvertPage)
+	http.HandleFunc("/transfer", userHandler.RequireKYC(userHandler.TransferPage, user.KYCBasic))
+	http.HandleFunc("/convert", userHandler.RequireKYC(userHandler.ConvertPage, user.KYCBasic))
 	http.HandleFunc("/transactions", userHandler.TransactionsPage)
+	http.HandleFunc("/transactions/view", userHandler.TransactionPage)
+	http.HandleFunc("/receipt", userHandler.RequireLogin(receiptHandler.ViewPage))
+	http.HandleFunc("/receipt/pdf", userHandler.RequireLogin(receiptHandler.PDFPage))
+	http.HandleFunc("/receipt/verify", receiptHandler.VerifyPage)
+	http.HandleFunc("/refund", userHandler.RefundPage)
 	http.HandleFunc("/logout", userHandler.LogoutPage)
 	http.HandleFunc("/about", userHandler.AboutPage)
+	http.HandleFunc("/limits", userHandler.LimitsPage)
+	http.HandleFunc("/events", userHandler.RequireLogin(userHandler.EventsPage))
+	http.HandleFunc("/notifications", userHandler.RequireLogin(notificationHandler.ListPage))
+	http.HandleFunc("/notifications/read", userHandler.RequireLogin(notificationHandler.ReadPage))
+	http.HandleFunc("/notifications/settings", userHandler.RequireLogin(notificationHandler.SettingsPage))
+	http.HandleFunc("/requests", userHandler.RequireLogin(payRequestHandler.ListPage))
+	http.HandleFunc("/requests/approve", userHandler.RequireLogin(payRequestHandler.ApprovePage))
+	http.HandleFunc("/requests/decline", userHandler.RequireLogin(payRequestHandler.DeclinePage))
+	http.HandleFunc("/requests/cancel", userHandler.RequireLogin(payRequestHandler.CancelPage))
+	http.HandleFunc("/kyc", userHandler.RequireLogin(kycHandler.Page))
+	http.HandleFunc("/qr", userHandler.RequireLogin(qrHandler.GeneratePage))
+	http.HandleFunc("/qr/image", qrHandler.ImagePage)
+	http.HandleFunc("/pay", userHandler.RequireKYC(qrHandler.PayPage, user.KYCBasic))
+	http.HandleFunc("/scheduled", userHandler.RequireKYC(scheduleHandler.ListPage, user.KYCBasic))
+	http.HandleFunc("/scheduled/pause", userHandler.RequireKYC(scheduleHandler.PausePage, user.KYCBasic))
+	http.HandleFunc("/scheduled/resume", userHandler.RequireKYC(scheduleHandler.ResumePage, user.KYCBasic))
+	http.HandleFunc("/scheduled/cancel", userHandler.RequireKYC(scheduleHandler.CancelPage, user.KYCBasic))
+
+	http.HandleFunc("/webhooks", userHandler.RequireKYC(webhookHandler.ListPage, user.KYCFull))
+	http.HandleFunc("/webhooks/disable", userHandler.RequireKYC(webhookHandler.DisablePage, user.KYCFull))
+	http.HandleFunc("/webhooks/ping", userHandler.RequireKYC(webhookHandler.PingPage, user.KYCFull))
+	http.HandleFunc("/webhooks/deliveries", userHandler.RequireKYC(webhookHandler.DeliveriesPage, user.KYCFull))
+	http.HandleFunc("/webhooks/retry", userHandler.RequireKYC(webhookHandler.RetryPage, user.KYCFull))
+
+	http.HandleFunc("/api-keys", userHandler.RequireKYC(apiKeyHandler.ListPage, user.KYCFull))
+	http.HandleFunc("/api-keys/revoke", userHandler.RequireLogin(apiKeyHandler.RevokePage))
+
+	// JSON API: Authorization: Bearer <API-ключ или токен OAuth2>
+	http.HandleFunc("/api/oauth/token", apiKeyHandler.TokenPage)
+	http.HandleFunc("/api/v1/me", apiAuth.Require(apiHandler.MePage, apikey.ScopeRead))
+	http.HandleFunc("/api/v1/transactions", apiAuth.Require(apiHandler.TransactionsPage, apikey.ScopeRead))
+	http.HandleFunc("/api/v1/transfers", apiAuth.Require(apiHandler.TransferPage, apikey.ScopeTransfer))
+	http.HandleFunc("/api/v1/events", apiAuth.Require(userHandler.EventsPage, apikey.ScopeRead))
+
+	// Админка
+	staff := []string{user.RoleSupport, user.RoleAdmin}
+	http.HandleFunc("/admin", userHandler.RequireRole(adminHandler.SearchPage, staff...))
+	http.HandleFunc("/admin/user", userHandler.RequireRole(adminHandler.UserPage, staff...))
+	http.HandleFunc("/admin/freeze", userHandler.RequireRole(adminHandler.FreezePage, staff...))
+	http.HandleFunc("/admin/reverse", userHandler.RequireRole(adminHandler.ReversePage, user.RoleAdmin))
+	http.HandleFunc("/admin/adjust", userHandler.RequireRole(adminHandler.AdjustPage, user.RoleAdmin))
+	http.HandleFunc("/admin/tier", userHandler.RequireRole(adminHandler.TierPage, user.RoleAdmin))
+	http.HandleFunc("/admin/kyc", userHandler.RequireRole(kycHandler.QueuePage, staff...))
+	http.HandleFunc("/admin/kyc/approve", userHandler.RequireRole(kycHandler.ApprovePage, staff...))
+	http.HandleFunc("/admin/kyc/reject", userHandler.RequireRole(kycHandler.RejectPage, staff...))
+	http.HandleFunc("/admin/kyc/document", userHandler.RequireRole(kycHandler.DocumentPage, staff...))
+	http.HandleFunc("/admin/audit", userHandler.RequireRole(adminHandler.AuditPage, user.RoleAdmin))
+	http.HandleFunc("/admin/audit/verify", userHandler.RequireRole(adminHandler.AuditVerifyPage, user.RoleAdmin))
+	http.HandleFunc("/admin/webhooks", userHandler.RequireRole(systemWebhookHandler.ListPage, user.RoleAdmin))
+	http.HandleFunc("/admin/webhooks/disable", userHandler.RequireRole(systemWebhookHandler.DisablePage, user.RoleAdmin))
+	http.HandleFunc("/admin/webhooks/ping", userHandler.RequireRole(systemWebhookHandler.PingPage, user.RoleAdmin))
+	http.HandleFunc("/admin/webhooks/deliveries", userHandler.RequireRole(systemWebhookHandler.DeliveriesPage, user.RoleAdmin))
+	http.HandleFunc("/admin/webhooks/retry", userHandler.RequireRole(systemWebhookHandler.RetryPage, user.RoleAdmin))
 
-	log.Println("Сервер запущен на http://localhost:8080/login")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	// Проверки для оркестратора: жив ли процесс и готов ли он принимать запросы
+	http.HandleFunc("/healthz", checker.LivenessPage)
+	http.HandleFunc("/readyz", checker.ReadinessPage)
+
+	// Метрики Prometheus; при заданном metrics_token нужен Authorization: Bearer <токен>
+	http.Handle("/metrics", metrics.Handler(cfg.MetricsToken))
+
+	limiter, err := ratelimit.New(cfg.RateLimit, http.DefaultServeMux, func(r *http.Request) string {
+		return rateLimitUser(r, userHandler)
+	})
+	if err != nil {
+		fatal("не удалось настроить ограничение частоты запросов", err)
+	}
+	defer limiter.Close()
+
+	// Middleware открывают спан трассировки, присваивают каждому запросу request_id,
+	// пишут итоговую запись о нём, ставят заголовки безопасности и CSP, замеряют
+	// длительность по маршрутам и отклоняют запросы сверх ограничения частоты
+	handler := security.Middleware(cfg.SecurityHeaders, metrics.Middleware(limiter.Middleware(http.DefaultServeMux)))
+	server := &http.Server{
+		Addr:              ":8080",
+		Handler:           tracing.Middleware(logging.Middleware(handler)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// Потоки /events живут, пока открыта вкладка, — закрываем их, иначе Shutdown их ждёт
+	server.RegisterOnShutdown(bus.Close)
+
+	go func() {
+		slog.Info("сервер запущен", "url", "http://localhost:8080/login")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("сервер остановлен", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	shutdown(server, checker)
+}
+
+const (
+	// drainDelay — сколько /readyz отвечает 503 до остановки, чтобы балансировщик
+	// успел убрать экземпляр из ротации
+	drainDelay = 5 * time.Second
+	// shutdownTimeout — сколько ждём завершения начатых запросов
+	shutdownTimeout = 20 * time.Second
+)
+
+// shutdown останавливает сервер: сначала снимает готовность, потом дожидается запросов
+func shutdown(server *http.Server, checker *health.Checker) {
+	slog.Info("остановка сервера")
+	checker.SetShuttingDown()
+	time.Sleep(drainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("не все запросы завершились до остановки", "err", err)
+		return
+	}
+	slog.Info("сервер остановлен")
+}
+
+// ratesRefresh — как часто обновлять курсы валют, по умолчанию раз в час
+func ratesRefresh(cfg *config.Config) time.Duration {
+	if cfg.RatesRefreshMinutes <= 0 {
+		return time.Hour
+	}
+	return time.Duration(cfg.RatesRefreshMinutes) * time.Minute
+}
+
+// rateLimitUser — ключ пользователя для ограничения частоты: id по cookie входа,
+// для API — хеш ключа из Authorization, чтобы не проверять его дважды
+func rateLimitUser(r *http.Request, users *user.UserHandler) string {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		sum := sha256.Sum256([]byte(strings.TrimSpace(bearer)))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+	userID, err := users.SessionUserID(r)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// fatal пишет ошибку запуска и завершает процесс
+func fatal(msg string, err error) {
+	if err != nil {
+		slog.Error(msg, "err", err)
+	} else {
+		slog.Error(msg)
+	}
+	os.Exit(1)
 }